@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"prog/Checker"
+	"prog/Events"
+)
+
+func main() {
+
+	// Set application flags
+	dirFlag := flag.String("logs", "logs", "Directory with the event logs of the run")
+	nFlag := flag.Int("n", 0, "Number of peers in the run (default derived from the logs)")
+	maxFlag := flag.Duration("max", 0, "Maximum duration of an election, e.g. 5s (default unbounded)")
+
+	// Retrieve flags value
+	flag.Parse()
+
+	// Read the events of the run
+	events, err := Events.ReadDir(*dirFlag)
+	if err != nil {
+		log.Fatalln("Read events error:", err)
+	}
+
+	// Check the run and print the report
+	report := Checker.Check(events, Checker.Options{Peers: *nFlag, MaxLatency: *maxFlag})
+	report.Write(os.Stdout)
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,355 @@
+package Checker
+
+import (
+	"fmt"
+	"io"
+	"prog/Events"
+	"prog/Utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the checked properties
+const (
+	SAFETY    = "at most one coordinator per term"
+	AGREEMENT = "surviving peers agree on the coordinator"
+	VALIDITY  = "coordinator is the highest live peer"
+	LATENCY   = "election latency"
+	CAUSALITY = "coordinator after a crash knew the crashed one"
+)
+
+// Options of the checker
+type Options struct {
+	Peers      int           // Number of peers in the network, if 0 it is derived from the events
+	MaxLatency time.Duration // Maximum duration of an election, if 0 latency is not bounded
+}
+
+// Property struct, result of the check of a single property
+type Property struct {
+	Name    string
+	Passed  bool
+	Details []string
+}
+
+// Report struct, result of the check of a run
+type Report struct {
+	Properties  []Property
+	Coordinator int             // Coordinator agreed by the surviving peers, -1 if there's no agreement
+	Survivors   []int           // Peers that did not crash or leave
+	Crashed     []int           // Peers that crashed or left and did not restart
+	Elections   []time.Duration // Duration of each completed election
+	Passed      bool
+}
+
+// Election episode, from the first ELECTION event to the recognition of a coordinator by all live peers
+type episode struct {
+	start   time.Time
+	pending map[int]bool // Live peers that have not recognized a coordinator yet
+}
+
+// Check the events of a run and return the report
+func Check(events []Events.Event, opt Options) Report {
+	events = append([]Events.Event(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	// Collect the peers and the crashed peers, a peer that left the network is counted as crashed
+	peers := make(map[int]bool)
+	for i := 0; i < opt.Peers; i++ {
+		peers[i] = true
+	}
+	crashed := make(map[int]bool)
+	for _, e := range events {
+		if e.Peer >= 0 {
+			peers[e.Peer] = true
+		}
+		if e.Type == Events.CRASH || e.Type == Events.LEAVE {
+			crashed[e.Peer] = true
+		}
+		if e.Type == Events.RESTART {
+			delete(crashed, e.Peer)
+		}
+	}
+
+	r := Report{Coordinator: -1}
+	for _, p := range sortedKeys(peers) {
+		if crashed[p] {
+			r.Crashed = append(r.Crashed, p)
+		} else {
+			r.Survivors = append(r.Survivors, p)
+		}
+	}
+
+	r.Properties = append(r.Properties, checkSafety(events))
+	agreement, final := checkAgreement(events, r.Survivors)
+	r.Properties = append(r.Properties, agreement)
+	if agreement.Passed {
+		r.Coordinator = final
+	}
+	r.Properties = append(r.Properties, checkValidity(r.Coordinator, r.Survivors, transferred(events)))
+	latency, durations := checkLatency(events, peers, opt.MaxLatency)
+	r.Properties = append(r.Properties, latency)
+	r.Elections = durations
+	r.Properties = append(r.Properties, checkCausality(events))
+
+	r.Passed = true
+	for _, p := range r.Properties {
+		r.Passed = r.Passed && p.Passed
+	}
+	return r
+}
+
+// Check that in each term at most one peer declared itself coordinator
+func checkSafety(events []Events.Event) Property {
+	p := Property{Name: SAFETY, Passed: true}
+	claims := make(map[int]map[int]bool) // Term -> peers that declared themselves coordinator
+	for _, e := range events {
+		if e.Type == Events.COORDINATOR && e.To == e.Peer {
+			if claims[e.Term] == nil {
+				claims[e.Term] = make(map[int]bool)
+			}
+			claims[e.Term][e.Peer] = true
+		}
+	}
+	for _, t := range sortedKeys(claims) {
+		if len(claims[t]) > 1 {
+			p.Passed = false
+			p.Details = append(p.Details, fmt.Sprintf("term %d has coordinators %v", t, sortedKeys(claims[t])))
+		}
+	}
+	return p
+}
+
+// Check that the first peer that declares itself coordinator after the crash of the coordinator knew it: a
+// recognition of the crashed coordinator in its term must happen before the new claim. With Ring the peers
+// learn the coordinator from the initiator of the election, so the recognitions of any peer count. A claim
+// concurrent with all of them is made by a peer that never heard of the crashed coordinator, e.g. behind a
+// partition. Events without vector clocks are not checked
+func checkCausality(events []Events.Event) Property {
+	p := Property{Name: CAUSALITY, Passed: true}
+	known := make(map[[2]int][][]int) // [coordinator, term] -> vector clocks of its recognitions
+	var leader, crashed *Events.Event // Last claim of a coordinator, claim of the crashed coordinator
+	for i, e := range events {
+		if e.Type == Events.CRASH && leader != nil && e.Peer == leader.Peer {
+			crashed = leader
+		}
+		if e.Type != Events.COORDINATOR || len(e.Vector) == 0 {
+			continue
+		}
+		known[[2]int{e.To, e.Term}] = append(known[[2]int{e.To, e.Term}], e.Vector)
+		if e.To != e.Peer {
+			continue
+		}
+
+		c := crashed
+		leader, crashed = &events[i], nil
+		if c == nil || c.Peer == e.Peer {
+			continue
+		}
+		before, concurrent := false, true
+		for _, v := range known[[2]int{c.Peer, c.Term}] {
+			before = before || Utils.HappenedBefore(v, e.Vector)
+			concurrent = concurrent && Utils.Concurrent(v, e.Vector)
+		}
+		if before {
+			continue
+		}
+		relation := "is not causally after any recognition of"
+		if concurrent {
+			relation = "is concurrent with every recognition of"
+		}
+		p.Passed = false
+		p.Details = append(p.Details, fmt.Sprintf("claim of %d in term %d %s crashed coordinator %d in term %d",
+			e.Peer, e.Term, relation, c.Peer, c.Term))
+	}
+	return p
+}
+
+// Check that all surviving peers recognized the same coordinator at the end of the run
+func checkAgreement(events []Events.Event, survivors []int) (Property, int) {
+	p := Property{Name: AGREEMENT, Passed: true}
+	last := make(map[int]int) // Peer -> last recognized coordinator
+	for _, e := range events {
+		if e.Type == Events.COORDINATOR {
+			last[e.Peer] = e.To
+		}
+	}
+
+	final := -1
+	for _, s := range survivors {
+		c, ok := last[s]
+		switch {
+		case !ok:
+			p.Passed = false
+			p.Details = append(p.Details, fmt.Sprintf("peer %d never recognized a coordinator", s))
+		case final == -1:
+			final = c
+		case c != final:
+			p.Passed = false
+		}
+	}
+	if !p.Passed {
+		for _, s := range survivors {
+			if c, ok := last[s]; ok {
+				p.Details = append(p.Details, fmt.Sprintf("peer %d recognized %d", s, c))
+			}
+		}
+		return p, -1
+	}
+	if final == -1 {
+		p.Passed = false
+		p.Details = append(p.Details, "no surviving peer")
+	}
+	return p, final
+}
+
+// Check that the agreed coordinator is the surviving peer with the highest ID, or the peer that won
+// the election of a leadership transfer after the last election
+func checkValidity(coordinator int, survivors []int, transfer int) Property {
+	p := Property{Name: VALIDITY, Passed: true}
+	if len(survivors) == 0 || coordinator == -1 {
+		p.Passed = false
+		p.Details = append(p.Details, "no agreed coordinator")
+		return p
+	}
+	if coordinator == transfer {
+		p.Details = append(p.Details, fmt.Sprintf("coordinator %d won the election of a leadership transfer", coordinator))
+		return p
+	}
+	highest := survivors[len(survivors)-1]
+	if coordinator != highest {
+		p.Passed = false
+		p.Details = append(p.Details, fmt.Sprintf("coordinator is %d, highest live peer is %d", coordinator, highest))
+	}
+	return p
+}
+
+// Return the target of the last leadership transfer if no election started after it, -1 if none
+func transferred(events []Events.Event) int {
+	peer := -1
+	for _, e := range events {
+		switch e.Type {
+		case Events.TRANSFER:
+			peer = e.Peer
+		case Events.ELECTION:
+			peer = -1
+		}
+	}
+	return peer
+}
+
+// Check that each election completes and lasts at most max
+func checkLatency(events []Events.Event, peers map[int]bool, max time.Duration) (Property, []time.Duration) {
+	p := Property{Name: LATENCY, Passed: true}
+	var durations []time.Duration
+	var ep *episode
+
+	alive := make(map[int]bool)
+	for id := range peers {
+		alive[id] = true
+	}
+
+	for _, e := range events {
+		switch e.Type {
+
+		// A new election, or the election of a leadership transfer, opens an episode if there's not one in progress
+		case Events.ELECTION, Events.TRANSFER:
+			if ep == nil {
+				ep = &episode{start: e.Time, pending: make(map[int]bool)}
+				for id := range alive {
+					ep.pending[id] = true
+				}
+			}
+
+		case Events.COORDINATOR:
+			if ep != nil {
+				delete(ep.pending, e.Peer)
+			}
+
+		// A crashed peer, or a peer that left, is not waited anymore
+		case Events.CRASH, Events.LEAVE:
+			delete(alive, e.Peer)
+			if ep != nil {
+				delete(ep.pending, e.Peer)
+			}
+
+		// A restarted peer is waited again
+		case Events.RESTART:
+			alive[e.Peer] = true
+		}
+
+		// Close the episode when all live peers know the coordinator
+		if ep != nil && len(ep.pending) == 0 {
+			d := e.Time.Sub(ep.start)
+			durations = append(durations, d)
+			if max > 0 && d > max {
+				p.Passed = false
+				p.Details = append(p.Details, fmt.Sprintf("election started at %s lasted %s (max %s)",
+					ep.start.Format("15:04:05.000"), d, max))
+			}
+			ep = nil
+		}
+	}
+
+	if ep != nil {
+		p.Passed = false
+		p.Details = append(p.Details, fmt.Sprintf("election started at %s did not complete, peers %v "+
+			"did not recognize a coordinator", ep.start.Format("15:04:05.000"), sortedKeys(ep.pending)))
+	}
+	if len(durations) > 0 {
+		maxD := durations[0]
+		for _, d := range durations {
+			if d > maxD {
+				maxD = d
+			}
+		}
+		p.Details = append(p.Details, fmt.Sprintf("%d elections, longest %s", len(durations), maxD))
+	}
+	return p, durations
+}
+
+// Write the report in a human-readable format
+func (r Report) Write(w io.Writer) {
+	fmt.Fprintln(w, "Election run report")
+	fmt.Fprintln(w, "  Surviving peers:", r.Survivors)
+	fmt.Fprintln(w, "  Crashed peers:  ", r.Crashed)
+	if r.Coordinator >= 0 {
+		fmt.Fprintln(w, "  Coordinator:    ", r.Coordinator)
+	} else {
+		fmt.Fprintln(w, "  Coordinator:     no agreement")
+	}
+	for _, p := range r.Properties {
+		result := "PASS"
+		if !p.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "  [%s] %s\n", result, p.Name)
+		for _, d := range p.Details {
+			fmt.Fprintln(w, "         "+d)
+		}
+	}
+	if r.Passed {
+		fmt.Fprintln(w, "Result: PASS")
+	} else {
+		fmt.Fprintln(w, "Result: FAIL")
+	}
+}
+
+// String return the report in a human-readable format
+func (r Report) String() string {
+	var sb strings.Builder
+	r.Write(&sb)
+	return sb.String()
+}
+
+// Return the keys of a map in sorted order
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,316 @@
+package Checker
+
+import (
+	"prog/Events"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Event of a peer at ms milliseconds from the start of the run
+func event(ms, peer int, typ string, term int) Events.Event {
+	e := Events.New(typ)
+	e.Time = start.Add(time.Duration(ms) * time.Millisecond)
+	e.Peer = peer
+	e.Term = term
+	return e
+}
+
+// The peer recognized the coordinator c, c recognizing itself declares itself coordinator
+func recognize(ms, peer, c, term int) Events.Event {
+	e := event(ms, peer, Events.COORDINATOR, term)
+	e.To = c
+	return e
+}
+
+// Election of term won by c and recognized by all peers from 0 to n-1
+func won(ms, c, n, term int) []Events.Event {
+	events := []Events.Event{event(ms, 0, Events.ELECTION, term), recognize(ms+100, c, c, term)}
+	for p := 0; p < n; p++ {
+		if p != c {
+			events = append(events, recognize(ms+200, p, c, term))
+		}
+	}
+	return events
+}
+
+// Set the vector clock of an event
+func at(e Events.Event, vector ...int) Events.Event {
+	e.Vector = vector
+	return e
+}
+
+// Concatenate lists of events
+func join(lists ...[]Events.Event) []Events.Event {
+	var events []Events.Event
+	for _, l := range lists {
+		events = append(events, l...)
+	}
+	return events
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      []Events.Event
+		maxLatency  time.Duration
+		failed      []string // Properties that do not hold
+		coordinator int
+		survivors   []int
+		crashed     []int
+	}{
+		{
+			name:        "single election",
+			events:      won(0, 2, 3, 1),
+			coordinator: 2,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "two coordinators in one term",
+			events: join(won(0, 2, 3, 1), []Events.Event{
+				recognize(500, 1, 1, 1),
+				recognize(600, 1, 2, 1),
+			}),
+			failed:      []string{SAFETY},
+			coordinator: 2,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "survivors disagree",
+			events: join(won(0, 2, 3, 1), []Events.Event{
+				recognize(500, 0, 1, 2),
+			}),
+			failed:      []string{AGREEMENT, VALIDITY},
+			coordinator: -1,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name:        "coordinator is not the highest live peer",
+			events:      won(0, 1, 3, 1),
+			failed:      []string{VALIDITY},
+			coordinator: 1,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "unfinished election",
+			events: []Events.Event{
+				event(0, 0, Events.ELECTION, 1),
+				recognize(100, 2, 2, 1),
+				recognize(200, 1, 2, 1),
+			},
+			failed:      []string{AGREEMENT, VALIDITY, LATENCY},
+			coordinator: -1,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "election latency over the maximum",
+			events: []Events.Event{
+				event(0, 0, Events.ELECTION, 1),
+				recognize(1000, 2, 2, 1),
+				recognize(2000, 0, 2, 1),
+				recognize(3000, 1, 2, 1),
+			},
+			maxLatency:  time.Second,
+			failed:      []string{LATENCY},
+			coordinator: 2,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "crashed coordinator",
+			events: join(won(0, 2, 3, 1), []Events.Event{
+				event(1000, 2, Events.CRASH, 1),
+				event(2000, 0, Events.ELECTION, 2),
+				recognize(2100, 1, 1, 2),
+				recognize(2200, 0, 1, 2),
+			}),
+			coordinator: 1,
+			survivors:   []int{0, 1},
+			crashed:     []int{2},
+		},
+		{
+			name: "restarted coordinator",
+			events: join(won(0, 2, 3, 1), []Events.Event{
+				event(1000, 2, Events.CRASH, 1),
+				event(2000, 0, Events.ELECTION, 2),
+				recognize(2100, 1, 1, 2),
+				recognize(2200, 0, 1, 2),
+				event(3000, 2, Events.RESTART, 2),
+			}, won(3100, 2, 3, 3)),
+			coordinator: 2,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "coordinator that left",
+			events: join(won(0, 2, 3, 1), []Events.Event{
+				event(1000, 2, Events.LEAVE, 1),
+				event(1100, 1, Events.ELECTION, 2),
+				recognize(1200, 1, 1, 2),
+				recognize(1300, 0, 1, 2),
+			}),
+			coordinator: 1,
+			survivors:   []int{0, 1},
+			crashed:     []int{2},
+		},
+		{
+			name: "leadership transfer",
+			events: join(won(0, 2, 3, 1), []Events.Event{
+				event(1000, 1, Events.TRANSFER, 2),
+				recognize(1100, 1, 1, 2),
+				recognize(1200, 0, 1, 2),
+				recognize(1200, 2, 1, 2),
+			}),
+			coordinator: 1,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "election after a leadership transfer",
+			events: join(won(0, 2, 3, 1), []Events.Event{
+				event(1000, 1, Events.TRANSFER, 2),
+				recognize(1100, 1, 1, 2),
+				recognize(1200, 0, 1, 2),
+				recognize(1200, 2, 1, 2),
+				event(2000, 0, Events.ELECTION, 3),
+				recognize(2100, 1, 1, 3),
+				recognize(2200, 0, 1, 3),
+				recognize(2200, 2, 1, 3),
+			}),
+			failed:      []string{VALIDITY},
+			coordinator: 1,
+			survivors:   []int{0, 1, 2},
+		},
+		{
+			name: "coordinator after a crash knew the crashed one",
+			events: []Events.Event{
+				event(0, 0, Events.ELECTION, 1),
+				at(recognize(100, 2, 2, 1), 0, 0, 1),
+				at(recognize(200, 1, 2, 1), 0, 1, 2),
+				at(recognize(200, 0, 2, 1), 1, 0, 2),
+				at(event(1000, 2, Events.CRASH, 1), 0, 0, 3),
+				event(2000, 0, Events.ELECTION, 2),
+				at(recognize(2100, 1, 1, 2), 1, 3, 2),
+				at(recognize(2200, 0, 1, 2), 2, 3, 2),
+			},
+			coordinator: 1,
+			survivors:   []int{0, 1},
+			crashed:     []int{2},
+		},
+		{
+			name: "coordinator after a crash concurrent with the crashed one",
+			events: []Events.Event{
+				event(0, 0, Events.ELECTION, 1),
+				at(recognize(100, 2, 2, 1), 0, 0, 1),
+				at(recognize(200, 0, 2, 1), 1, 0, 2),
+				at(event(1000, 2, Events.CRASH, 1), 0, 0, 3),
+				event(2000, 0, Events.ELECTION, 2),
+				at(recognize(2100, 1, 1, 2), 0, 1, 0),
+				at(recognize(2200, 0, 1, 2), 2, 1, 2),
+			},
+			failed:      []string{CAUSALITY},
+			coordinator: 1,
+			survivors:   []int{0, 1},
+			crashed:     []int{2},
+		},
+		{
+			name: "ring coordinator that crashed after its claim",
+			events: []Events.Event{
+				event(0, 0, Events.ELECTION, 1),
+				at(recognize(100, 0, 2, 1), 4, 2, 2),
+				at(recognize(200, 1, 2, 1), 5, 4, 2),
+				at(recognize(300, 2, 2, 1), 6, 2, 4),
+				at(event(300, 2, Events.CRASH, 1), 6, 2, 5),
+				event(2000, 0, Events.ELECTION, 2),
+				at(recognize(2100, 0, 1, 2), 9, 6, 2),
+				at(recognize(2200, 1, 1, 2), 10, 8, 2),
+			},
+			coordinator: 1,
+			survivors:   []int{0, 1},
+			crashed:     []int{2},
+		},
+		{
+			name: "restarted coordinator claims again",
+			events: []Events.Event{
+				event(0, 0, Events.ELECTION, 1),
+				at(recognize(100, 2, 2, 1), 0, 0, 5),
+				at(recognize(200, 1, 2, 1), 0, 1, 5),
+				at(recognize(200, 0, 2, 1), 1, 0, 5),
+				at(event(1000, 2, Events.CRASH, 1), 0, 0, 6),
+				event(2000, 2, Events.RESTART, 1),
+				event(2100, 2, Events.ELECTION, 2),
+				at(recognize(2200, 2, 2, 2), 0, 0, 1),
+				at(recognize(2300, 1, 2, 2), 0, 2, 2),
+				at(recognize(2300, 0, 2, 2), 2, 0, 2),
+			},
+			coordinator: 2,
+			survivors:   []int{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Check(tt.events, Options{Peers: 3, MaxLatency: tt.maxLatency})
+
+			failed := make(map[string]bool)
+			for _, name := range tt.failed {
+				failed[name] = true
+			}
+			for _, p := range r.Properties {
+				if p.Passed == failed[p.Name] {
+					t.Errorf("property %q passed = %v, want %v, details %v", p.Name, p.Passed, !failed[p.Name],
+						p.Details)
+				}
+			}
+			if r.Passed != (len(tt.failed) == 0) {
+				t.Errorf("report passed = %v, want %v", r.Passed, len(tt.failed) == 0)
+			}
+			if r.Coordinator != tt.coordinator {
+				t.Errorf("coordinator = %d, want %d", r.Coordinator, tt.coordinator)
+			}
+			if !reflect.DeepEqual(r.Survivors, tt.survivors) {
+				t.Errorf("survivors = %v, want %v", r.Survivors, tt.survivors)
+			}
+			if !reflect.DeepEqual(r.Crashed, tt.crashed) {
+				t.Errorf("crashed = %v, want %v", r.Crashed, tt.crashed)
+			}
+		})
+	}
+}
+
+func TestCheckUnsortedEvents(t *testing.T) {
+	events := won(0, 2, 3, 1)
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	r := Check(events, Options{Peers: 3})
+	if !r.Passed {
+		t.Errorf("events out of order failed the check:\n%s", r)
+	}
+	if len(r.Elections) != 1 || r.Elections[0] != 200*time.Millisecond {
+		t.Errorf("elections = %v, want [200ms]", r.Elections)
+	}
+}
+
+func TestCausalityDetails(t *testing.T) {
+	events := []Events.Event{
+		at(recognize(0, 2, 2, 1), 0, 0, 1),
+		at(event(1000, 2, Events.CRASH, 1), 0, 0, 2),
+		at(recognize(2000, 1, 1, 2), 0, 1, 0),
+	}
+	p := checkCausality(events)
+	want := []string{"claim of 1 in term 2 is concurrent with every recognition of crashed coordinator 2 in term 1"}
+	if p.Passed || !reflect.DeepEqual(p.Details, want) {
+		t.Errorf("causality = %v %q, want false %q", p.Passed, p.Details, want)
+	}
+}
+
+func TestReportString(t *testing.T) {
+	r := Check(won(0, 1, 3, 1), Options{Peers: 3})
+	s := r.String()
+	for _, want := range []string{"[FAIL] " + VALIDITY, "coordinator is 1, highest live peer is 2", "Result: FAIL"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("report does not contain %q:\n%s", want, s)
+		}
+	}
+}
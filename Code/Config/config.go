@@ -0,0 +1,501 @@
+package Config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"prog/Events"
+	"prog/Network"
+	"prog/Utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Address struct, IP address and port of a service
+type Address struct {
+	IP   string `json:"ip"`
+	Port string `json:"port"`
+}
+
+// String return the address in the host:port form
+func (a Address) String() string {
+	return a.IP + ":" + a.Port
+}
+
+// Config struct, configuration of a run shared by launch.go, the register and the peers.
+// The values are read in order from the defaults, the config file, the environment and the flags
+type Config struct {
+	Register   Address           `json:"register"`
+	Replicas   []Address         `json:"replicas,omitempty"`    // Replicas of the register, Register is the only one if empty
+	Peer       Address           `json:"peer"`                  // The port is chosen at random if empty
+	Discovery  string            `json:"discovery,omitempty"`   // register or gossip
+	Seeds      []Address         `json:"seeds,omitempty"`       // Peers contacted first with gossip discovery
+	Network    Utils.NetworkConf `json:"network"`               // Delay models and message faults
+	Peers      int               `json:"peers,omitempty"`       // Number of peers in the network
+	Algorithm  string            `json:"algorithm,omitempty"`   // bully or ring
+	Delay      int               `json:"delay,omitempty"`       // Main parameter of the delay model in ms
+	DelayModel string            `json:"delay_model,omitempty"` // Used if the network has no default delay model
+	Heartbeat  int               `json:"heartbeat,omitempty"`   // Duration of heartbeat service shift in seconds
+	Failures   int               `json:"failures,omitempty"`    // Heartbeats without reply before a peer is down
+	Crash      []int             `json:"crash,omitempty"`       // Peers that crash while taking part in an election
+	LogLevel   string            `json:"log_level,omitempty"`   // error, info, debug or trace
+	LogDir     string            `json:"log_dir,omitempty"`     // Directory of the event logs
+	State      string            `json:"state,omitempty"`       // File of the register state, in LogDir if empty
+	Seed       int64             `json:"seed,omitempty"`        // If not zero, each peer seeds its random generator
+	Rejoin     int               `json:"-"`                     // ID of a restarted peer, -1 for a new peer
+	Replica    int               `json:"-"`                     // Index of the register replica in Replicas
+	File       string            `json:"-"`                     // Config file read, empty if none
+}
+
+// Discovery modes of the peers
+const (
+	REGISTER = "register" // The register service assigns the IDs and sends the peer list
+	GOSSIP   = "gossip"   // The peers exchange their addresses starting from the seeds, the register is not used
+)
+
+// Variables that can change while the services are running, the others require a restart
+var reloadable = map[string]bool{"DELAY": true, "DELAY_MODEL": true, "HEARTBEAT": true, "FAILURES": true,
+	"LOG_LEVEL": true, "NETWORK": true}
+
+// Default return the default configuration, the number of peers and the algorithm have no default
+func Default() Config {
+	return Config{
+		Register:   Address{IP: "127.0.0.1", Port: "1234"},
+		Peer:       Address{IP: "127.0.0.1"},
+		Discovery:  REGISTER,
+		Delay:      200,
+		DelayModel: Network.UNIFORM,
+		Heartbeat:  2,
+		Failures:   1,
+		LogLevel:   Events.LevelName(Events.INFO),
+		LogDir:     "logs",
+		Rejoin:     -1,
+	}
+}
+
+// Load return the configuration read from the defaults, the file and the environment
+func Load(path string) (Config, error) {
+	c := Default()
+	err := c.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = c.ReadEnv()
+	return c, err
+}
+
+// Parse return the configuration of a service: the file selected by the -config flag and the environment
+// are read first, then the other flags override them. The result is validated
+func Parse(name string, args []string) (Config, error) {
+
+	// The flags are parsed twice, the first time only to know the config file
+	var path string
+	var first Config
+	fs := flags(name, &first, &path)
+	err := fs.Parse(args)
+	if err != nil {
+		return first, err
+	}
+	c, err := Load(path)
+	if err != nil {
+		return c, err
+	}
+	fs = flags(name, &c, &path)
+	fs.SetOutput(io.Discard)
+	err = fs.Parse(args)
+	if err != nil {
+		return c, err
+	}
+	c.Algorithm = strings.ToLower(c.Algorithm)
+	c.DelayModel = strings.ToLower(c.DelayModel)
+	c.Discovery = strings.ToLower(c.Discovery)
+	return c, c.Validate()
+}
+
+// Define the flags of a service on the fields of c
+func flags(name string, c *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(path, "config", "config.json", "JSON file with the configuration")
+	fs.StringVar(&c.Discovery, "discovery", c.Discovery, "Discovery of the peers, register or gossip (DISCOVERY)")
+	fs.IntVar(&c.Peers, "peers", c.Peers, "Number of peers (PEERS)")
+	fs.StringVar(&c.Algorithm, "algo", c.Algorithm, "Election algorithm, bully or ring (ALGO)")
+	fs.IntVar(&c.Delay, "delay", c.Delay, "Main parameter of the delay model in ms (DELAY)")
+	fs.StringVar(&c.DelayModel, "delay-model", c.DelayModel, "Delay model (DELAY_MODEL)")
+	fs.IntVar(&c.Heartbeat, "heartbeat", c.Heartbeat, "Duration of heartbeat service shift in seconds (HEARTBEAT)")
+	fs.IntVar(&c.Failures, "failures", c.Failures, "Heartbeats without reply before a peer is down (FAILURES)")
+	fs.Var((*ids)(&c.Crash), "crash", "IDs of the peers that crash, e.g. 1,3 (CRASH)")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level of the events (LOG_LEVEL)")
+	fs.StringVar(&c.LogDir, "log-dir", c.LogDir, "Directory of the event logs (LOG_DIR)")
+	fs.StringVar(&c.State, "state", c.State, "File where the register saves its state (STATE)")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "Seed of the random generators (SEED)")
+	fs.IntVar(&c.Rejoin, "rejoin", c.Rejoin, "ID of a restarted peer (REJOIN)")
+	fs.IntVar(&c.Replica, "replica", c.Replica, "Index of the register replica (REPLICA)")
+	return fs
+}
+
+// ReadFile read a JSON config file, the fields that are not in the file keep their value
+func (c *Config) ReadFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	j, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(c)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	c.File = path
+	return nil
+}
+
+// ReadEnv read the environment variables that are set
+func (c *Config) ReadEnv() error {
+	return c.ReadVars(os.LookupEnv)
+}
+
+// ReadVars read the variables returned by lookup, with the names of the environment variables
+func (c *Config) ReadVars(lookup func(name string) (string, bool)) error {
+	var errs []string
+	str := func(name string, v *string) {
+		if s, ok := lookup(name); ok {
+			*v = s
+		}
+	}
+	num := func(name string, v *int) {
+		if s, ok := lookup(name); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not an integer", name, s))
+			}
+			*v = n
+		}
+	}
+	prob := func(name string, v *float64) {
+		if s, ok := lookup(name); ok {
+			p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a number", name, s))
+			}
+			*v = p
+		}
+	}
+	addrs := func(name string, v *[]Address) {
+		if s, ok := lookup(name); ok {
+			*v = nil
+			for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+				a, err := parseAddress(strings.TrimSpace(f))
+				if err != nil {
+					errs = append(errs, name+": "+err.Error())
+				}
+				*v = append(*v, a)
+			}
+		}
+	}
+
+	if s, ok := lookup("REGISTER"); ok {
+		a, err := parseAddress(s)
+		if err != nil {
+			errs = append(errs, "REGISTER: "+err.Error())
+		}
+		c.Register = a
+	}
+	addrs("REPLICAS", &c.Replicas)
+	num("REPLICA", &c.Replica)
+	str("PEER_IP", &c.Peer.IP)
+	str("PEER_PORT", &c.Peer.Port)
+	str("DISCOVERY", &c.Discovery)
+	addrs("SEEDS", &c.Seeds)
+	num("PEERS", &c.Peers)
+	str("ALGO", &c.Algorithm)
+	num("DELAY", &c.Delay)
+	str("DELAY_MODEL", &c.DelayModel)
+	num("HEARTBEAT", &c.Heartbeat)
+	num("FAILURES", &c.Failures)
+	if s, ok := lookup("CRASH"); ok {
+		err := (*ids)(&c.Crash).Set(s)
+		if err != nil {
+			errs = append(errs, "CRASH: "+err.Error())
+		}
+	}
+	str("LOG_LEVEL", &c.LogLevel)
+	str("LOG_DIR", &c.LogDir)
+	str("STATE", &c.State)
+	if s, ok := lookup("SEED"); ok {
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("SEED: %q is not an integer", s))
+		}
+		c.Seed = n
+	}
+	num("REJOIN", &c.Rejoin)
+
+	// The network replaces the one of the file, the probabilities override it
+	if s, ok := lookup("NETWORK"); ok {
+		c.Network = Utils.NetworkConf{}
+		err := json.Unmarshal([]byte(s), &c.Network)
+		if err != nil {
+			errs = append(errs, "NETWORK: "+err.Error())
+		}
+	}
+	prob("DROP", &c.Network.Drop)
+	prob("DUPLICATE", &c.Network.Duplicate)
+	prob("REORDER", &c.Network.Reorder)
+
+	c.Algorithm = strings.ToLower(c.Algorithm)
+	c.DelayModel = strings.ToLower(c.DelayModel)
+	c.Discovery = strings.ToLower(c.Discovery)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate check the configuration and return an error that describes all invalid values
+func (c Config) Validate() error {
+	var errs []string
+	if c.Register.IP == "" || c.Register.Port == "" {
+		errs = append(errs, fmt.Sprintf("register address %q is incomplete", c.Register.String()))
+	}
+	for _, r := range c.Replicas {
+		if r.IP == "" || r.Port == "" {
+			errs = append(errs, fmt.Sprintf("register replica address %q is incomplete", r.String()))
+		}
+	}
+	if c.Replica < 0 || (c.Replica > 0 && c.Replica >= len(c.Replicas)) {
+		errs = append(errs, fmt.Sprintf("register replica %d is not in the %d replicas", c.Replica, len(c.Replicas)))
+	}
+	if c.Discovery != REGISTER && c.Discovery != GOSSIP {
+		errs = append(errs, fmt.Sprintf("unknown discovery %q (select register or gossip)", c.Discovery))
+	}
+	if c.Discovery == GOSSIP && len(c.Seeds) == 0 {
+		errs = append(errs, "gossip discovery requires at least one seed")
+	}
+	for _, a := range c.Seeds {
+		if a.IP == "" || a.Port == "" {
+			errs = append(errs, fmt.Sprintf("seed address %q is incomplete", a.String()))
+		}
+	}
+	if c.Peers < 2 {
+		errs = append(errs, fmt.Sprintf("at least 2 peers are required, got %d", c.Peers))
+	}
+	if c.Algorithm != "bully" && c.Algorithm != "ring" {
+		errs = append(errs, fmt.Sprintf("unknown algorithm %q (select bully or ring)", c.Algorithm))
+	}
+	if c.Delay < 0 {
+		errs = append(errs, fmt.Sprintf("the delay must not be negative, got %d", c.Delay))
+	}
+	if c.Heartbeat < 1 {
+		errs = append(errs, fmt.Sprintf("the heartbeat shift must be at least 1 second, got %d", c.Heartbeat))
+	}
+	if c.Failures < 1 {
+		errs = append(errs, fmt.Sprintf("at least 1 heartbeat without reply is needed to detect a failure, got %d",
+			c.Failures))
+	}
+	for _, id := range c.Crash {
+		if id < 0 || (c.Peers >= 2 && id >= c.Peers) {
+			errs = append(errs, fmt.Sprintf("crashing peer %d is not in the network", id))
+		}
+	}
+	if c.Rejoin >= 0 && c.Peers >= 2 && c.Rejoin >= c.Peers {
+		errs = append(errs, fmt.Sprintf("rejoining peer %d is not in the network", c.Rejoin))
+	}
+	_, err := Events.ParseLevel(c.LogLevel)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	model, err := Network.NewModel(c.DelayConf())
+	if err == nil {
+		_, err = Network.New(model, c.Network)
+	}
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// DelayConf return the default delay model of the network, or the one selected by DelayModel and Delay
+func (c Config) DelayConf() Utils.DelayConf {
+	if c.Network.Delay != nil {
+		return *c.Network.Delay
+	}
+	return Network.DefaultConf(c.DelayModel, c.Delay)
+}
+
+// StateFile return the file where the register saves the peers and the assigned IDs, each replica has its own
+func (c Config) StateFile() string {
+	if c.State != "" {
+		return c.State
+	}
+	if len(c.Replicas) > 1 {
+		return filepath.Join(c.LogDir, fmt.Sprintf("register_%d.json", c.Replica))
+	}
+	return filepath.Join(c.LogDir, "register.json")
+}
+
+// RegisterAddrs return the addresses of the register replicas, only the register address if there are none
+func (c Config) RegisterAddrs() []string {
+	if len(c.Replicas) == 0 {
+		return []string{c.Register.String()}
+	}
+	addrs := make([]string, len(c.Replicas))
+	for i, r := range c.Replicas {
+		addrs[i] = r.String()
+	}
+	return addrs
+}
+
+// SeedAddrs return the addresses of the seeds
+func (c Config) SeedAddrs() []string {
+	addrs := make([]string, len(c.Seeds))
+	for i, a := range c.Seeds {
+		addrs[i] = a.String()
+	}
+	return addrs
+}
+
+// RegisterAddr return the address of the register replica selected by Replica
+func (c Config) RegisterAddr() Address {
+	if len(c.Replicas) == 0 {
+		return c.Register
+	}
+	return c.Replicas[c.Replica]
+}
+
+// Env return the environment variables that pass the configuration to the services
+func (c Config) Env() map[string]string {
+	env := map[string]string{
+		"REGISTER":    c.Register.String(),
+		"PEER_IP":     c.Peer.IP,
+		"DISCOVERY":   c.Discovery,
+		"PEERS":       strconv.Itoa(c.Peers),
+		"ALGO":        c.Algorithm,
+		"DELAY":       strconv.Itoa(c.Delay),
+		"DELAY_MODEL": c.DelayModel,
+		"HEARTBEAT":   strconv.Itoa(c.Heartbeat),
+		"FAILURES":    strconv.Itoa(c.Failures),
+		"CRASH":       ids(c.Crash).String(),
+		"LOG_LEVEL":   c.LogLevel,
+		"LOG_DIR":     c.LogDir,
+		"STATE":       c.State,
+		"SEED":        strconv.FormatInt(c.Seed, 10),
+	}
+	if len(c.Seeds) > 0 {
+		env["SEEDS"] = strings.Join(c.SeedAddrs(), ",")
+	}
+	if len(c.Replicas) > 0 {
+		env["REPLICAS"] = strings.Join(c.RegisterAddrs(), ",")
+	}
+	j, err := json.Marshal(c.Network)
+	if err == nil {
+		env["NETWORK"] = string(j)
+	}
+	return env
+}
+
+// Vars return the variables of b that differ from the ones of a
+func Vars(a, b Config) map[string]string {
+	vars := make(map[string]string)
+	old := a.Env()
+	for k, v := range b.Env() {
+		if old[k] != v {
+			vars[k] = v
+		}
+	}
+	return vars
+}
+
+// Reload apply the variables to a copy of c, as ReadVars, but only the ones that can change at run time.
+// It returns the new configuration and the description of the changes, like "HEARTBEAT: 2 -> 1"
+func (c Config) Reload(vars map[string]string) (Config, []string, error) {
+	next := c
+	known := make(map[string]bool)
+	err := next.ReadVars(func(name string) (string, bool) {
+		known[name] = true
+		v, ok := vars[name]
+		return v, ok
+	})
+	for k := range vars {
+		if !known[k] && err == nil {
+			err = fmt.Errorf("unknown variable %s", k)
+		}
+	}
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		return c, nil, err
+	}
+
+	// Keep only the variables that can change
+	old, cur := c.Env(), next.Env()
+	names := make([]string, 0, len(cur))
+	for k := range cur {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	apply := make(map[string]string)
+	var diff []string
+	for _, k := range names {
+		if old[k] == cur[k] {
+			continue
+		}
+		if !reloadable[k] {
+			diff = append(diff, fmt.Sprintf("%s: %s -> %s ignored, it requires a restart", k, old[k], cur[k]))
+			continue
+		}
+		apply[k] = cur[k]
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", k, old[k], cur[k]))
+	}
+	next = c
+	err = next.ReadVars(func(name string) (string, bool) {
+		v, ok := apply[name]
+		return v, ok
+	})
+	return next, diff, err
+}
+
+// Parse an address like host:port
+func parseAddress(s string) (Address, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return Address{}, fmt.Errorf("%q is not an address like host:port", s)
+	}
+	return Address{IP: s[:i], Port: s[i+1:]}, nil
+}
+
+// List of peer IDs separated by commas, used by the crash flag and variable
+type ids []int
+
+func (l ids) String() string {
+	s := make([]string, len(l))
+	for i, id := range l {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ",")
+}
+
+// Set parse a list like "1,3", the separator ";" is also accepted
+func (l *ids) Set(s string) error {
+	*l = nil
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+		id, err := strconv.Atoi(f)
+		if err != nil {
+			return fmt.Errorf("%q is not a peer ID", f)
+		}
+		*l = append(*l, id)
+	}
+	return nil
+}
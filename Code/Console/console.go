@@ -0,0 +1,388 @@
+package Console
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"prog/Faults"
+	"prog/Utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Help of the commands
+const help = `Commands:
+  status                 show the state of each peer
+  kill ID                make the peer crash
+  leave ID               make the peer leave the network gracefully
+  restart ID             start a new process for a crashed peer, it rejoins with the same ID
+  restart register [N]   kill the register service, or its replica N, and start it again
+  pause ID DURATION      make the peer unresponsive, e.g. pause 2 5s
+  partition 0,1 | 2,3    split the network in groups that cannot communicate
+  heal                   remove all partitions
+  delay MS [ID]          set the main parameter of the default delay model of all peers or of one
+  elect ID               make the peer start an election
+  transfer ID            make the coordinator hand the leadership to the peer
+  reload [VAR=value ...] change the configuration of the running network, e.g. reload HEARTBEAT=1,
+                         without variables the register and the peers apply the changes of their config file
+  members                show the membership known by the register and its version
+  watch [DURATION]       print the changes of the membership for a duration, default 1m
+  help                   show this help
+  quit                   stop the run`
+
+var errQuit = errors.New("quit")
+
+// Console of a running network, the commands are sent to the control service of the peers
+type Console struct {
+	Register string             // Address of the register service, or comma separated addresses of its replicas
+	Restart  func(id int) error // Start a new process for a peer, nil if not supported
+	Out      io.Writer          // Output of the commands
+
+	RestartRegister func(replica int) error // Restart a register replica, nil if not supported
+}
+
+// Run read and execute commands until the input ends or the quit command
+func (c *Console) Run(in io.Reader) {
+	fmt.Fprintln(c.Out, "Control console, type help for the list of commands.")
+	s := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(c.Out, "> ")
+		if !s.Scan() {
+			return
+		}
+		err := c.Exec(s.Text())
+		if err == errQuit {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(c.Out, "Error:", err)
+		}
+	}
+}
+
+// Exec execute a command
+func (c *Console) Exec(line string) error {
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return nil
+	}
+	// These commands do not need the register service
+	offline := f[0] == "help" || f[0] == "quit" || f[0] == "exit" || (len(f) >= 2 && f[1] == "register")
+	peers, err := c.peers()
+	if err != nil && !offline {
+		return fmt.Errorf("register service: %w", err)
+	}
+
+	switch cmd, args := strings.ToLower(f[0]), f[1:]; cmd {
+	case "status":
+		c.status(peers)
+		return nil
+
+	case "kill", "leave", "elect":
+		p, err := target(peers, args, 1)
+		if err != nil {
+			return err
+		}
+		method := map[string]string{"kill": "Control.Crash", "leave": "Control.Leave", "elect": "Control.Elect"}[cmd]
+		return Faults.Call(p, method, 0)
+
+	case "transfer":
+		p, err := target(peers, args, 1)
+		if err != nil {
+			return err
+		}
+		leader, err := coordinator(peers)
+		if err != nil {
+			return err
+		}
+		return Faults.Call(leader, "Control.Transfer", &p.ID)
+
+	case "restart":
+		if len(args) >= 1 && args[0] == "register" {
+			if c.RestartRegister == nil {
+				return errors.New("restart of the register service is not supported by this console")
+			}
+			replica := 0
+			if len(args) == 2 {
+				replica, err = strconv.Atoi(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid replica %q", args[1])
+				}
+			}
+			return c.RestartRegister(replica)
+		}
+		p, err := target(peers, args, 1)
+		if err != nil {
+			return err
+		}
+		if c.Restart == nil {
+			return errors.New("restart is not supported by this console")
+		}
+		if _, err := Faults.GetStatus(p); err == nil {
+			return fmt.Errorf("peer %d is running, kill it first", p.ID)
+		}
+		return c.Restart(p.ID)
+
+	case "pause":
+		p, err := target(peers, args, 2)
+		if err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			return err
+		}
+		return Faults.Call(p, "Control.Pause", &d)
+
+	case "partition":
+		groups, err := parseGroups(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		return Faults.Partition(peers, groups)
+
+	case "heal":
+		return Faults.Heal(peers)
+
+	case "delay":
+		if len(args) < 1 {
+			return errors.New("usage: delay MS [ID]")
+		}
+		ms, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		targets := peers
+		if len(args) > 1 {
+			p, err := target(peers, args[1:], 1)
+			if err != nil {
+				return err
+			}
+			targets = []Utils.Peer{p}
+		}
+		var first error
+		for _, p := range targets {
+			err := Faults.Call(p, "Control.SetDelay", &ms)
+			if err != nil && first == nil {
+				first = fmt.Errorf("peer %d: %w", p.ID, err)
+			}
+		}
+		return first
+
+	case "reload":
+		return c.reload(f[1:])
+
+	case "members":
+		return c.members()
+
+	case "watch":
+		d := time.Minute
+		if len(args) == 1 {
+			d, err = time.ParseDuration(args[0])
+			if err != nil {
+				return err
+			}
+		} else if len(args) > 1 {
+			return errors.New("usage: watch [DURATION]")
+		}
+		return c.watch(d)
+
+	case "help":
+		fmt.Fprintln(c.Out, help)
+		return nil
+
+	case "quit", "exit":
+		return errQuit
+	}
+	return fmt.Errorf("unknown command %q, type help for the list of commands", f[0])
+}
+
+// Print the state of each registered peer
+func (c *Console) status(peers []Utils.Peer) {
+	fmt.Fprintf(c.Out, "%4s  %-21s %-7s %11s %5s %9s %7s %s\n", "PEER", "ADDRESS", "STATE", "COORDINATOR", "TERM",
+		"ELECTIONS", "MEMBERS", "ELECTION")
+	for _, p := range peers {
+		st, err := Faults.GetStatus(p)
+		if err != nil {
+			fmt.Fprintf(c.Out, "%4d  %-21s %-7s\n", p.ID, p.IP+":"+p.Port, "down")
+			continue
+		}
+		state := "live"
+		if st.Paused {
+			state = "paused"
+		}
+		running := ""
+		if st.Election {
+			running = "yes"
+		}
+		members := "-"
+		if st.Members > 0 {
+			members = "v" + strconv.Itoa(st.Members)
+		}
+		fmt.Fprintf(c.Out, "%4d  %-21s %-7s %11d %5d %9d %7s %s\n", p.ID, p.IP+":"+p.Port, state, st.Coordinator,
+			st.Term, st.Elections, members, running)
+	}
+}
+
+// Send the variables to the register service, that applies them and forwards them to the peers
+func (c *Console) reload(args []string) error {
+	vars := make(map[string]string)
+	for _, a := range args {
+		k, v, ok := strings.Cut(a, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid variable %q, use VAR=value", a)
+		}
+		vars[strings.ToUpper(k)] = v
+	}
+	cli, err := Utils.DialRegister(c.Register)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	var reply []string
+	err = cli.Call("Register.Reload", vars, &reply)
+	for _, l := range reply {
+		fmt.Fprintln(c.Out, l)
+	}
+	return err
+}
+
+// Print the membership known by the register service
+func (c *Console) members() error {
+	m, err := c.membership(Utils.WatchArgs{})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.Out, "Membership version", m.Version)
+	states := make(map[int]string)
+	for _, id := range m.Down {
+		states[id] = "down"
+	}
+	for _, id := range m.Left {
+		states[id] = "left"
+	}
+	fmt.Fprintf(c.Out, "%4s  %-21s %s\n", "PEER", "ADDRESS", "STATE")
+	for _, p := range m.Peers {
+		state := states[p.ID]
+		if state == "" {
+			state = "up"
+		}
+		fmt.Fprintf(c.Out, "%4d  %-21s %s\n", p.ID, p.IP+":"+p.Port, state)
+	}
+	return nil
+}
+
+// Print the changes of the membership until the duration expires, with long polls of the register service
+func (c *Console) watch(d time.Duration) error {
+	m, err := c.membership(Utils.WatchArgs{})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.Out, "Watching the membership from version", m.Version, "for", d)
+	end := time.Now().Add(d)
+	for v := m.Version; time.Now().Before(end); v = m.Version {
+		m, err = c.membership(Utils.WatchArgs{Version: v, Timeout: time.Until(end)})
+		if err != nil {
+			return err
+		}
+		if m.Version > v && m.Events == nil {
+			fmt.Fprintln(c.Out, "Membership changed to version", m.Version, "but the changes are no longer available")
+		}
+		for _, e := range m.Events {
+			fmt.Fprintf(c.Out, "v%-4d %s %-8s peer %d %s:%s\n", e.Version, e.Time.Format("15:04:05.000"), e.Type,
+				e.Peer.ID, e.Peer.IP, e.Peer.Port)
+		}
+	}
+	return nil
+}
+
+// Call Register.Watch on the register service
+func (c *Console) membership(args Utils.WatchArgs) (Utils.Membership, error) {
+	var m Utils.Membership
+	cli, err := Utils.DialRegister(c.Register)
+	if err != nil {
+		return m, err
+	}
+	defer cli.Close()
+	err = cli.Call("Register.Watch", &args, &m)
+	return m, err
+}
+
+// Return the peers registered on the register service sorted by ID
+func (c *Console) peers() ([]Utils.Peer, error) {
+	cli, err := Utils.DialRegister(c.Register)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	var peers []Utils.Peer
+	err = cli.Call("Register.GetPeers", 0, &peers)
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers, err
+}
+
+// Return the peer whose ID is the first argument, n is the number of arguments of the command
+func target(peers []Utils.Peer, args []string, n int) (Utils.Peer, error) {
+	if len(args) != n {
+		return Utils.Peer{}, fmt.Errorf("%d arguments expected, type help for the usage", n)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Utils.Peer{}, fmt.Errorf("invalid peer ID %q", args[0])
+	}
+	for _, p := range peers {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Utils.Peer{}, fmt.Errorf("peer %d is not registered", id)
+}
+
+// Return the live coordinator known by the majority of live peers
+func coordinator(peers []Utils.Peer) (Utils.Peer, error) {
+	live := make(map[int]Utils.Peer)
+	votes := make(map[int]int)
+	for _, p := range peers {
+		st, err := Faults.GetStatus(p)
+		if err == nil {
+			live[p.ID] = p
+			votes[st.Coordinator]++
+		}
+	}
+	leader, max := -1, 0
+	for c, n := range votes {
+		if _, ok := live[c]; ok && (n > max || (n == max && c > leader)) {
+			leader, max = c, n
+		}
+	}
+	if leader < 0 {
+		return Utils.Peer{}, errors.New("no live coordinator")
+	}
+	return live[leader], nil
+}
+
+// Parse groups of peers like "0,1 | 2,3"
+func parseGroups(s string) ([][]int, error) {
+	var groups [][]int
+	for _, g := range strings.Split(s, "|") {
+		var group []int
+		for _, f := range strings.FieldsFunc(g, func(r rune) bool { return r == ',' || r == ' ' }) {
+			id, err := strconv.Atoi(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer ID %q", f)
+			}
+			group = append(group, id)
+		}
+		if len(group) == 0 {
+			return nil, errors.New("empty group, usage: partition 0,1 | 2,3")
+		}
+		groups = append(groups, group)
+	}
+	if len(groups) < 2 {
+		return nil, errors.New("at least two groups are required, usage: partition 0,1 | 2,3")
+	}
+	return groups, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"prog/Config"
+	"prog/Console"
+	"strings"
+)
+
+func main() {
+
+	// Set application flags
+	cFlag := flag.String("c", "config.json", "Configuration file with the address of the register service")
+
+	// Retrieve flags value
+	flag.Parse()
+
+	// Read the configuration to retrieve IP address and port of the register service
+	conf, err := Config.Load(*cFlag)
+	if err != nil {
+		log.Fatalln("Configuration error:", err)
+	}
+	c := Console.Console{Register: strings.Join(conf.RegisterAddrs(), ","), Out: os.Stdout}
+
+	// Execute the command of the arguments, or read the commands from the standard input
+	if flag.NArg() == 0 {
+		c.Run(os.Stdin)
+		return
+	}
+	err = c.Exec(strings.Join(flag.Args(), " "))
+	if err != nil {
+		log.Fatalln("Error:", err)
+	}
+}
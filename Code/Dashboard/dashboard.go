@@ -0,0 +1,215 @@
+package Dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"prog/Events"
+	"prog/Faults"
+	"prog/Utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Consecutive polls without answer after which a peer is considered dead
+const deadPolls = 3
+
+// Number of events shown under the peers
+const lastEvents = 10
+
+// ANSI escape sequences
+const (
+	clear  = "\033[H\033[2J"
+	reset  = "\033[0m"
+	bold   = "\033[1m"
+	green  = "\033[32m"
+	yellow = "\033[33m"
+	red    = "\033[31m"
+)
+
+// Dashboard of a running network, redrawn on a terminal from the status of the peers
+type Dashboard struct {
+	Register string        // Address of the register service, or comma separated addresses of its replicas
+	Logs     string        // Directory of the event logs, the last events are shown if not empty
+	Interval time.Duration // Refresh interval, 1s if zero
+	Out      io.Writer     // Terminal
+
+	mu      sync.Mutex
+	stopped bool
+	start   time.Time
+	last    time.Time            // Time of the previous poll
+	misses  map[int]int          // Consecutive polls without answer by peer
+	prev    map[int]Utils.Status // Status of the previous poll, to compute the message rates
+}
+
+// Run redraw the dashboard until Stop is called
+func (d *Dashboard) Run() {
+	if d.Interval <= 0 {
+		d.Interval = time.Second
+	}
+	d.mu.Lock()
+	d.start = time.Now()
+	d.misses = make(map[int]int)
+	d.prev = make(map[int]Utils.Status)
+	d.mu.Unlock()
+
+	for {
+		if !d.Draw() {
+			return
+		}
+		time.Sleep(d.Interval)
+	}
+}
+
+// Stop the refresh, the current frame is completed before returning
+func (d *Dashboard) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.mu.Unlock()
+}
+
+// Draw poll the peers and redraw the dashboard, return false if the dashboard has been stopped
+func (d *Dashboard) Draw() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return false
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(d.last).Seconds()
+	if d.last.IsZero() {
+		elapsed = 0
+	}
+	d.last = now
+
+	var events []Events.Event
+	if d.Logs != "" {
+		events, _ = Events.ReadDir(d.Logs)
+	}
+	crashed := crashedPeers(events)
+
+	var b bytes.Buffer
+	b.WriteString(clear)
+	fmt.Fprintf(&b, "%sElection dashboard%s  %s  up %s\n\n", bold, reset, now.Format("15:04:05"),
+		now.Sub(d.start).Truncate(time.Second))
+
+	peers, err := d.peers()
+	if err != nil {
+		fmt.Fprintln(&b, "Register service not reachable:", err)
+		d.Out.Write(b.Bytes())
+		return true
+	}
+
+	fmt.Fprintf(&b, "%s%4s  %-10s %11s %5s %-8s %9s %7s %7s %8s%s\n", bold, "PEER", "STATE", "COORDINATOR", "TERM",
+		"ELECTION", "ELECTIONS", "SENT/s", "RECV/s", "FAILED/s", reset)
+	votes := make(map[int]int)
+	alive := 0
+	for _, p := range peers {
+		st, err := Faults.GetStatus(p)
+		if err != nil {
+			d.misses[p.ID]++
+			state, color := "suspected", yellow
+			if crashed[p.ID] || d.misses[p.ID] >= deadPolls {
+				state, color = "dead", red
+			}
+			delete(d.prev, p.ID)
+			fmt.Fprintf(&b, "%4d  %s%-10s%s %11s %5s\n", p.ID, color, state, reset, "-", "-")
+			continue
+		}
+		d.misses[p.ID] = 0
+
+		state, color := "alive", green
+		if st.Paused {
+			state, color = "suspected", yellow
+		} else {
+			alive++
+			votes[st.Coordinator]++
+		}
+		coord := "-"
+		if st.Coordinator >= 0 {
+			coord = fmt.Sprint(st.Coordinator)
+		}
+		running := "no"
+		if st.Election {
+			running = "yes"
+		}
+		sent, recv, failed := "-", "-", "-"
+		if prev, ok := d.prev[p.ID]; ok && elapsed > 0 {
+			sent = rate(st.Sent, prev.Sent, elapsed)
+			recv = rate(st.Received, prev.Received, elapsed)
+			failed = rate(st.Failed, prev.Failed, elapsed)
+		}
+		d.prev[p.ID] = st
+		fmt.Fprintf(&b, "%4d  %s%-10s%s %11s %5d %-8s %9d %7s %7s %8s\n", p.ID, color, state, reset, coord, st.Term,
+			running, st.Elections, sent, recv, failed)
+	}
+
+	// Coordinator known by most live peers
+	leader, n := -1, 0
+	for c, v := range votes {
+		if v > n || (v == n && c > leader) {
+			leader, n = c, v
+		}
+	}
+	fmt.Fprintln(&b)
+	if leader >= 0 {
+		fmt.Fprintf(&b, "Coordinator %d, known by %d of %d live peers\n", leader, n, alive)
+	} else {
+		fmt.Fprintln(&b, "No coordinator")
+	}
+
+	// Last protocol events, at info level
+	if len(events) > 0 {
+		fmt.Fprintf(&b, "\n%sLast events%s\n", bold, reset)
+		var info []Events.Event
+		for _, e := range events {
+			if e.Level == Events.LevelName(Events.INFO) || e.Level == Events.LevelName(Events.ERROR) {
+				info = append(info, e)
+			}
+		}
+		if len(info) > lastEvents {
+			info = info[len(info)-lastEvents:]
+		}
+		for _, e := range info {
+			fmt.Fprintf(&b, "  %s  %s\n", e.Time.Local().Format("15:04:05.000"), e.Text)
+		}
+	}
+
+	d.Out.Write(b.Bytes())
+	return true
+}
+
+// Return the peers registered on the register service sorted by ID
+func (d *Dashboard) peers() ([]Utils.Peer, error) {
+	cli, err := Utils.DialRegister(d.Register)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	var peers []Utils.Peer
+	err = cli.Call("Register.GetPeers", 0, &peers)
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers, err
+}
+
+// Return the peers whose last crash or restart event is a crash
+func crashedPeers(events []Events.Event) map[int]bool {
+	crashed := make(map[int]bool)
+	for _, e := range events {
+		if e.Type == Events.CRASH || e.Type == Events.RESTART {
+			crashed[e.Peer] = e.Type == Events.CRASH
+		}
+	}
+	return crashed
+}
+
+// Return the number of messages per second between two polls
+func rate(cur, prev map[string]int, elapsed float64) string {
+	n := 0
+	for t, v := range cur {
+		n += v - prev[t]
+	}
+	return fmt.Sprintf("%.1f", float64(n)/elapsed)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"prog/Events"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Step of the diagram, a message between two peers or a note over a peer
+type step struct {
+	time   time.Time
+	note   bool   // If true the step is a note over the peer from
+	from   int    // Sender of the message or peer of the note
+	to     int    // Receiver of the message
+	label  string // Message type or note text
+	reply  bool   // If true the message is an OK reply
+	failed bool   // If true the message was not delivered
+}
+
+func main() {
+
+	// Set application flags
+	dirFlag := flag.String("logs", "logs", "Directory with the event logs of the run")
+	fFlag := flag.String("f", "mermaid", "Output format (select \"mermaid\", \"plantuml\" or \"text\")")
+	oFlag := flag.String("o", "", "Output file (default standard output)")
+	hbFlag := flag.Bool("hb", false, "Include HEARTBEAT messages")
+	lFlag := flag.Bool("lamport", false, "Order the events by Lamport timestamp instead of wall clock time")
+
+	// Retrieve flags value
+	flag.Parse()
+
+	// Read the events of the run
+	events, err := Events.ReadDir(*dirFlag)
+	if err != nil {
+		log.Fatalln("Read events error:", err)
+	}
+
+	// Causal order, ties broken by peer ID
+	if *lFlag {
+		sort.SliceStable(events, func(i, j int) bool {
+			if events[i].Lamport != events[j].Lamport {
+				return events[i].Lamport < events[j].Lamport
+			}
+			return events[i].Peer < events[j].Peer
+		})
+	}
+	steps, peers := buildSteps(events, *hbFlag)
+
+	// Open output
+	var out io.Writer = os.Stdout
+	if *oFlag != "" {
+		f, err := os.Create(*oFlag)
+		if err != nil {
+			log.Fatalln("Create output error:", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	// Write the diagram
+	switch strings.ToLower(*fFlag) {
+	case "mermaid":
+		writeMermaid(out, steps, peers)
+	case "plantuml":
+		writePlantUML(out, steps, peers)
+	case "text":
+		writeText(out, steps, peers)
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+// Build the steps of the diagram from the events and return them with the sorted list of peers
+func buildSteps(events []Events.Event, hb bool) ([]step, []int) {
+	var steps []step
+	seen := make(map[int]bool)
+
+	for _, e := range events {
+		if e.Peer >= 0 {
+			seen[e.Peer] = true
+		}
+
+		switch e.Type {
+
+		// Messages are drawn from the sender side, OK replies included
+		case Events.SEND:
+			if e.Msg == "HEARTBEAT" && !hb {
+				continue
+			}
+			label := e.Msg
+			if e.Msg != "OK" {
+				label += " (term " + strconv.Itoa(e.Term) + ")"
+			}
+			steps = append(steps, step{time: e.Time, from: e.From, to: e.To, label: label, reply: e.Msg == "OK"})
+
+		// Mark the last message sent with the same sender, receiver and type as failed
+		case Events.SEND_FAIL:
+			for i := len(steps) - 1; i >= 0; i-- {
+				s := steps[i]
+				if !s.note && !s.failed && s.from == e.From && s.to == e.To && strings.HasPrefix(s.label, e.Msg) {
+					steps[i].failed = true
+					break
+				}
+			}
+
+		case Events.ELECTION:
+			steps = append(steps, note(e, "starts election (term "+strconv.Itoa(e.Term)+")"))
+
+		case Events.COORDINATOR:
+			steps = append(steps, note(e, "coordinator is P"+strconv.Itoa(e.To)))
+
+		case Events.FAILURE:
+			steps = append(steps, note(e, "timeout: P"+strconv.Itoa(e.From)+" is down"))
+
+		case Events.CRASH:
+			steps = append(steps, note(e, "CRASH"))
+
+		case Events.RESTART:
+			steps = append(steps, note(e, "RESTART"))
+		}
+	}
+
+	// Peers that only appear as receivers
+	for _, s := range steps {
+		if !s.note && s.to >= 0 {
+			seen[s.to] = true
+		}
+	}
+	peers := make([]int, 0, len(seen))
+	for p := range seen {
+		peers = append(peers, p)
+	}
+	sort.Ints(peers)
+
+	return steps, peers
+}
+
+// Return a note step over the peer of the event
+func note(e Events.Event, text string) step {
+	return step{time: e.Time, note: true, from: e.Peer, to: -1, label: text}
+}
+
+// Write the diagram in Mermaid format
+func writeMermaid(w io.Writer, steps []step, peers []int) {
+	fmt.Fprintln(w, "sequenceDiagram")
+	for _, p := range peers {
+		fmt.Fprintf(w, "    participant P%d as Peer %d\n", p, p)
+	}
+	for _, s := range steps {
+		switch {
+		case s.note:
+			fmt.Fprintf(w, "    Note over P%d: %s\n", s.from, s.label)
+		case s.failed:
+			fmt.Fprintf(w, "    P%d-xP%d: %s (lost)\n", s.from, s.to, s.label)
+		case s.reply:
+			fmt.Fprintf(w, "    P%d-->>P%d: %s\n", s.from, s.to, s.label)
+		default:
+			fmt.Fprintf(w, "    P%d->>P%d: %s\n", s.from, s.to, s.label)
+		}
+	}
+}
+
+// Write the diagram in PlantUML format
+func writePlantUML(w io.Writer, steps []step, peers []int) {
+	fmt.Fprintln(w, "@startuml")
+	for _, p := range peers {
+		fmt.Fprintf(w, "participant \"Peer %d\" as P%d\n", p, p)
+	}
+	for _, s := range steps {
+		switch {
+		case s.note:
+			fmt.Fprintf(w, "note over P%d: %s\n", s.from, s.label)
+		case s.failed:
+			fmt.Fprintf(w, "P%d ->x P%d: %s (lost)\n", s.from, s.to, s.label)
+		case s.reply:
+			fmt.Fprintf(w, "P%d --> P%d: %s\n", s.from, s.to, s.label)
+		default:
+			fmt.Fprintf(w, "P%d -> P%d: %s\n", s.from, s.to, s.label)
+		}
+	}
+	fmt.Fprintln(w, "@enduml")
+}
+
+// Write a plain-text space-time diagram: one column for each peer, one row for each step
+func writeText(w io.Writer, steps []step, peers []int) {
+	const width = 8 // Width of a peer column
+
+	// Column of each peer
+	col := make(map[int]int)
+	for i, p := range peers {
+		col[p] = i*width + width/2
+	}
+
+	// Header
+	header := []byte(strings.Repeat(" ", len(peers)*width))
+	for _, p := range peers {
+		name := "P" + strconv.Itoa(p)
+		copy(header[col[p]-len(name)/2:], name)
+	}
+	fmt.Fprintf(w, "%-12s %s\n", "TIME", strings.TrimRight(string(header), " "))
+
+	for _, s := range steps {
+
+		// Draw the life lines
+		row := []byte(strings.Repeat(" ", len(peers)*width))
+		for _, p := range peers {
+			row[col[p]] = '|'
+		}
+
+		if s.note {
+			row[col[s.from]] = '*'
+		} else {
+			a, b := col[s.from], col[s.to]
+			lo, hi := a, b
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			for i := lo + 1; i < hi; i++ {
+				row[i] = '-'
+			}
+			row[a] = 'o'
+			switch {
+			case s.failed:
+				row[b] = 'x'
+			case b > a:
+				row[b] = '>'
+			default:
+				row[b] = '<'
+			}
+		}
+
+		label := s.label
+		if s.note {
+			label = "P" + strconv.Itoa(s.from) + " " + label
+		} else if s.failed {
+			label += " (lost)"
+		}
+		fmt.Fprintf(w, "%-12s %s  %s\n", s.time.Format("15:04:05.000"), string(row), label)
+	}
+}
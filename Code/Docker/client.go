@@ -0,0 +1,275 @@
+package Docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default address of the Docker Engine API
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Client of the Docker Engine API, with the endpoints used to run the network
+type Client struct {
+	base string       // Base URL of the requests
+	http *http.Client // HTTP client connected to the daemon
+}
+
+// ContainerConfig struct, configuration of a new container
+type ContainerConfig struct {
+	Image      string            `json:"Image"`
+	Env        []string          `json:"Env,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+	HostConfig HostConfig        `json:"HostConfig"`
+}
+
+// HostConfig struct, host resources of a new container
+type HostConfig struct {
+	NetworkMode string   `json:"NetworkMode,omitempty"`
+	Binds       []string `json:"Binds,omitempty"`
+}
+
+// Container struct, a container returned by ListContainers
+type Container struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+	State string   `json:"State"`
+}
+
+// Error returned by the daemon
+type Error struct {
+	Status  int
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("docker: %s (status %d)", e.Message, e.Status)
+}
+
+// NewClient return a client of the daemon listening on host: "unix:///path" or "tcp://ip:port". If host
+// is empty DOCKER_HOST is used, then DefaultHost
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		return &Client{base: "http://docker", http: &http.Client{Transport: &http.Transport{DialContext: dial}}}, nil
+	case "tcp", "http":
+		return &Client{base: "http://" + u.Host, http: &http.Client{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported docker host %q (select unix:// or tcp://)", host)
+}
+
+// Ping check that the daemon is reachable
+func (c *Client) Ping() error {
+	return c.do("GET", "/_ping", nil, nil, nil)
+}
+
+// BuildImage build an image from a tar archive of the context, the build output is written on out
+func (c *Client) BuildImage(tag, dockerfile string, context io.Reader, out io.Writer) error {
+	q := url.Values{"t": {tag}, "dockerfile": {dockerfile}, "rm": {"1"}}
+	resp, err := c.request("POST", "/build?"+q.Encode(), "application/x-tar", context)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The output is a stream of JSON messages, an error message makes the build fail
+	d := json.NewDecoder(resp.Body)
+	for {
+		var m struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		err := d.Decode(&m)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if m.Error != "" {
+			return fmt.Errorf("build %s: %s", tag, m.Error)
+		}
+		if out != nil {
+			io.WriteString(out, m.Stream)
+		}
+	}
+}
+
+// CreateNetwork create a bridge network and return its ID
+func (c *Client) CreateNetwork(name string, labels map[string]string) (string, error) {
+	var reply struct {
+		ID string `json:"Id"`
+	}
+	body := map[string]any{"Name": name, "Driver": "bridge", "Labels": labels}
+	err := c.do("POST", "/networks/create", nil, body, &reply)
+	return reply.ID, err
+}
+
+// RemoveNetwork remove a network
+func (c *Client) RemoveNetwork(id string) error {
+	return c.do("DELETE", "/networks/"+id, nil, nil, nil)
+}
+
+// CreateContainer create a container and return its ID
+func (c *Client) CreateContainer(name string, conf ContainerConfig) (string, error) {
+	var reply struct {
+		ID string `json:"Id"`
+	}
+	err := c.do("POST", "/containers/create", url.Values{"name": {name}}, conf, &reply)
+	return reply.ID, err
+}
+
+// StartContainer start a container
+func (c *Client) StartContainer(id string) error {
+	return c.do("POST", "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// KillContainer send a signal to the main process of a container
+func (c *Client) KillContainer(id, signal string) error {
+	return c.do("POST", "/containers/"+id+"/kill", url.Values{"signal": {signal}}, nil, nil)
+}
+
+// RemoveContainer remove a container, force kills it if running
+func (c *Client) RemoveContainer(id string, force bool) error {
+	return c.do("DELETE", "/containers/"+id, url.Values{"force": {fmt.Sprint(force)}}, nil, nil)
+}
+
+// ListContainers return all containers with the given label
+func (c *Client) ListContainers(label string) ([]Container, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	var reply []Container
+	err = c.do("GET", "/containers/json", url.Values{"all": {"1"}, "filters": {string(filters)}}, nil, &reply)
+	return reply, err
+}
+
+// Logs follow the output of a container and write each line on out until the container stops.
+// If since is not zero the lines written before are skipped
+func (c *Client) Logs(id string, since time.Time, out func(line string)) error {
+	q := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	if !since.IsZero() {
+		q.Set("since", strconv.FormatInt(since.Unix(), 10))
+	}
+	resp, err := c.request("GET", "/containers/"+id+"/logs?"+q.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Without a TTY stdout and stderr are multiplexed in frames with an 8 bytes header
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(demux(resp.Body, pw))
+	}()
+	s := bufio.NewScanner(pr)
+	for s.Scan() {
+		out(s.Text())
+	}
+	return s.Err()
+}
+
+// Copy the payload of the frames of a multiplexed stream
+func demux(r io.Reader, w io.Writer) error {
+	var header [8]byte
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:])))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Send a request with a JSON body and decode the JSON reply
+func (c *Client) do(method, path string, query url.Values, body, reply any) error {
+	var r io.Reader
+	ctype := ""
+	if body != nil {
+		j, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(j)
+		ctype = "application/json"
+	}
+	if query != nil {
+		path += "?" + query.Encode()
+	}
+	resp, err := c.request(method, path, ctype, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if reply == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// Send a request and return the response, a status code of 400 or higher is returned as Error
+func (c *Client) request(method, path, ctype string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		e := &Error{Status: resp.StatusCode}
+		b, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(b, e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(b))
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// IsNotFound check if err is returned for a missing object
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Status == http.StatusNotFound
+}
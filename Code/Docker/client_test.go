@@ -0,0 +1,390 @@
+package Docker
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Request received by the fake daemon
+type call struct {
+	Method string
+	Path   string
+	Query  string
+	Type   string
+	Body   string
+}
+
+// Fake Docker daemon: it records the requests and answers with the handler of their path, if any, or with
+// an empty reply. The requests of the logs are not recorded, they are sent by the goroutines of the cluster
+type daemon struct {
+	t        *testing.T
+	mu       sync.Mutex
+	calls    []call
+	handlers map[string]http.HandlerFunc // "METHOD /path" -> handler
+}
+
+func newDaemon(t *testing.T) (*daemon, *Client) {
+	d := &daemon{t: t, handlers: make(map[string]http.HandlerFunc)}
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	c, err := NewClient("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, c
+}
+
+func (d *daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/logs") {
+		return
+	}
+	b, _ := io.ReadAll(r.Body)
+	d.mu.Lock()
+	d.calls = append(d.calls, call{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), string(b)})
+	h := d.handlers[r.Method+" "+r.URL.Path]
+	d.mu.Unlock()
+	if h != nil {
+		h(w, r)
+		return
+	}
+
+	// The created objects have the ID of their name
+	if strings.HasSuffix(r.URL.Path, "/create") {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			var body struct{ Name string }
+			json.Unmarshal(b, &body)
+			name = body.Name
+		}
+		json.NewEncoder(w).Encode(map[string]string{"Id": "id-" + name})
+		return
+	}
+	if r.URL.Path == "/containers/json" {
+		io.WriteString(w, "[]")
+	}
+}
+
+// Set the handler of the requests "METHOD /path"
+func (d *daemon) handle(route string, h http.HandlerFunc) {
+	d.mu.Lock()
+	d.handlers[route] = h
+	d.mu.Unlock()
+}
+
+// Return the requests received as "METHOD /path?query", and clear them
+func (d *daemon) take() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var reqs []string
+	for _, c := range d.calls {
+		r := c.Method + " " + c.Path
+		if c.Query != "" {
+			r += "?" + c.Query
+		}
+		reqs = append(reqs, r)
+	}
+	d.calls = nil
+	return reqs
+}
+
+// Return the first request "METHOD /path"
+func (d *daemon) find(route string) call {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.calls {
+		if c.Method+" "+c.Path == route {
+			return c
+		}
+	}
+	d.t.Fatalf("request %s not received", route)
+	return call{}
+}
+
+// Reply with a daemon error
+func fail(status int, msg string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"message": msg})
+	}
+}
+
+// Address of a listener that stands for a register replica
+func listen(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// Cluster of a register and two peers started on the fake daemon
+func started(t *testing.T) (*daemon, *Cluster) {
+	d, cli := newDaemon(t)
+	c := &Cluster{Client: cli, Peers: 2, Register: listen(t), Out: io.Discard}
+	err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.take()
+	return d, c
+}
+
+func TestNewClient(t *testing.T) {
+	c, err := NewClient("tcp://127.0.0.1:2375")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.base != "http://127.0.0.1:2375" {
+		t.Errorf("base = %q, want http://127.0.0.1:2375", c.base)
+	}
+	_, err = NewClient("ssh://host")
+	if err == nil {
+		t.Error("ssh host accepted")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	d, cli := newDaemon(t)
+	d.handle("POST /build", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"stream":"Step 1/2"}`+"\n"+`{"stream":"Step 2/2"}`)
+	})
+	c := &Cluster{Client: cli, Context: t.TempDir()}
+	err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET /_ping",
+		"POST /build?dockerfile=Code%2FDocker%2Fregister_dockerfile&rm=1&t=election-register",
+		"POST /build?dockerfile=Code%2FDocker%2Fpeer_dockerfile&rm=1&t=election-peer",
+	}
+	if got := d.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+
+	// An error message in the output makes the build fail
+	d.handle("POST /build", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"error":"no such file"}`)
+	})
+	err = c.Build()
+	if err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("build error = %v, want the error of the output", err)
+	}
+}
+
+func TestBuildContextIsTar(t *testing.T) {
+	d, cli := newDaemon(t)
+	c := &Cluster{Client: cli, Context: t.TempDir()}
+	err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.find("POST /build").Type; got != "application/x-tar" {
+		t.Errorf("content type = %q, want application/x-tar", got)
+	}
+}
+
+func TestStart(t *testing.T) {
+	d, cli := newDaemon(t)
+	d.handle("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"Id":"old","Names":["/election-peer-1"],"State":"exited"}]`)
+	})
+	c := &Cluster{Client: cli, Peers: 2, Register: listen(t), Out: io.Discard, Env: map[string]string{"ALGORITHM": "bully"}}
+	err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET /containers/json?all=1&filters=%7B%22label%22%3A%5B%22prog.election%22%5D%7D",
+		"DELETE /containers/old?force=true",
+		"POST /containers/create?name=election-register",
+		"POST /containers/id-election-register/start",
+		"POST /containers/create?name=election-peer-1",
+		"POST /containers/id-election-peer-1/start",
+		"POST /containers/create?name=election-peer-2",
+		"POST /containers/id-election-peer-2/start",
+	}
+	if got := d.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+func TestStartContainerConfig(t *testing.T) {
+	d, cli := newDaemon(t)
+	c := &Cluster{Client: cli, Peers: 1, Register: listen(t), Out: io.Discard, Env: map[string]string{"ALGORITHM": "bully"}}
+	err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conf ContainerConfig
+	err = json.Unmarshal([]byte(d.find("POST /containers/create").Body), &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ContainerConfig{
+		Image:      RegisterImage,
+		Env:        conf.Env,
+		Labels:     map[string]string{Label: "register"},
+		HostConfig: HostConfig{NetworkMode: "host"},
+	}
+	if !reflect.DeepEqual(conf, want) {
+		t.Errorf("register config = %+v, want %+v", conf, want)
+	}
+	for _, v := range []string{"ALGORITHM=bully", "REPLICA=0"} {
+		if !strings.Contains(strings.Join(conf.Env, " "), v) {
+			t.Errorf("register environment %q does not contain %s", conf.Env, v)
+		}
+	}
+}
+
+func TestKill(t *testing.T) {
+	d, c := started(t)
+	err := c.Kill("peer-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"POST /containers/id-election-peer-2/kill?signal=SIGKILL"}
+	if got := d.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+
+	err = c.Kill("peer-3")
+	if err == nil {
+		t.Error("kill of a missing container succeeded")
+	}
+}
+
+func TestRestartRegister(t *testing.T) {
+	d, c := started(t)
+
+	// The container is still stopping for the first start attempts
+	var mu sync.Mutex
+	attempts := 0
+	d.handle("POST /containers/id-election-register/start", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			fail(http.StatusConflict, "container is restarting")(w, r)
+		}
+	})
+	err := c.RestartRegister(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"POST /containers/id-election-register/kill?signal=SIGKILL",
+		"POST /containers/id-election-register/start",
+		"POST /containers/id-election-register/start",
+		"POST /containers/id-election-register/start",
+	}
+	if got := d.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+
+	err = c.RestartRegister(1)
+	if err == nil {
+		t.Error("restart of a missing replica succeeded")
+	}
+	c.Gossip = true
+	err = c.RestartRegister(0)
+	if err == nil {
+		t.Error("restart of the register succeeded with gossip discovery")
+	}
+}
+
+func TestRestartRegisterKillError(t *testing.T) {
+	d, c := started(t)
+	d.handle("POST /containers/id-election-register/kill", fail(http.StatusInternalServerError, "kill failed"))
+	err := c.RestartRegister(0)
+	if err == nil || !strings.Contains(err.Error(), "kill failed") {
+		t.Errorf("restart error = %v, want the error of the kill", err)
+	}
+	want := []string{"POST /containers/id-election-register/kill?signal=SIGKILL"}
+	if got := d.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+func TestStop(t *testing.T) {
+	d, cli := newDaemon(t)
+	c := &Cluster{Client: cli, Peers: 2, Register: listen(t), Network: "election", Out: io.Discard}
+	err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.take()
+
+	// A container already removed is not an error
+	d.handle("DELETE /containers/id-election-peer-1", fail(http.StatusNotFound, "no such container"))
+	c.Stop()
+
+	got := d.take()
+	want := []string{
+		"DELETE /containers/id-election-peer-1?force=true",
+		"DELETE /containers/id-election-peer-2?force=true",
+		"DELETE /containers/id-election-register?force=true",
+	}
+	if len(got) != len(want)+1 {
+		t.Fatalf("requests = %q, want the removal of 3 containers and of the network", got)
+	}
+
+	// The containers are removed concurrently, then the network
+	containers := append([]string(nil), got[:3]...)
+	sort.Strings(containers)
+	if !reflect.DeepEqual(containers, want) {
+		t.Errorf("container requests = %q, want %q", containers, want)
+	}
+	if got[3] != "DELETE /networks/id-election" {
+		t.Errorf("last request = %q, want DELETE /networks/id-election", got[3])
+	}
+
+	// The containers are forgotten
+	c.Stop()
+	if got := d.take(); len(got) != 0 {
+		t.Errorf("second stop requests = %q, want none", got)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	d, cli := newDaemon(t)
+	d.handle("POST /containers/missing/start", fail(http.StatusNotFound, "no such container"))
+	d.handle("POST /containers/broken/start", fail(http.StatusInternalServerError, "server error"))
+
+	err := cli.StartContainer("missing")
+	if !IsNotFound(err) {
+		t.Errorf("IsNotFound(%v) = false, want true", err)
+	}
+	if !strings.Contains(err.Error(), "no such container") {
+		t.Errorf("error = %q, want the message of the daemon", err)
+	}
+
+	err = cli.StartContainer("broken")
+	if IsNotFound(err) {
+		t.Errorf("IsNotFound(%v) = true, want false", err)
+	}
+	if IsNotFound(nil) || IsNotFound(io.EOF) {
+		t.Error("IsNotFound is true for an error that is not a missing object")
+	}
+}
@@ -0,0 +1,340 @@
+package Docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Label of the containers and networks created for a run
+const Label = "prog.election"
+
+// Images of the services, built from the dockerfiles in the Docker directory
+const (
+	RegisterImage = "election-register"
+	PeerImage     = "election-peer"
+)
+
+// Cluster of a register and peer containers driven through the Docker Engine API
+type Cluster struct {
+	Client   *Client           // Client of the Docker daemon
+	Context  string            // Build context, the root of the repository
+	Peers    int               // Number of peer containers
+	Register string            // Address of the register, or comma separated addresses of its replicas
+	Gossip   bool              // If true the peers join with gossip discovery, Register is the list of seeds
+	Network  string            // "host" (default) or the name of a bridge network created for the run
+	Logs     string            // Directory mounted on the event logs directory of the peers
+	Env      map[string]string // Configuration passed to the containers as environment variables
+	Out      io.Writer         // Output of the containers, each line prefixed with the container name
+
+	mu         sync.Mutex
+	containers map[string]string // Container name -> ID
+	network    string            // ID of the network created for the run
+	mode       string            // Network mode of the containers
+	out        sync.Mutex        // Serialize the lines written on Out
+}
+
+// Build the register and peer images
+func (c *Cluster) Build() error {
+	err := c.Client.Ping()
+	if err != nil {
+		return fmt.Errorf("docker daemon not reachable: %w", err)
+	}
+	context, err := archive(c.Context)
+	if err != nil {
+		return err
+	}
+	for _, img := range []struct{ tag, dockerfile string }{
+		{RegisterImage, "Code/Docker/register_dockerfile"},
+		{PeerImage, "Code/Docker/peer_dockerfile"},
+	} {
+		log.Println("Building image", img.tag)
+		err = c.Client.BuildImage(img.tag, img.dockerfile, bytes.NewReader(context), os.Stdout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start the register, wait until it's listening, then start the peers. With gossip discovery only the peers
+// are started
+func (c *Cluster) Start() error {
+	if c.Out == nil {
+		c.Out = os.Stdout
+	}
+	c.mu.Lock()
+	c.containers = make(map[string]string)
+	c.mu.Unlock()
+
+	// Remove the containers left by a previous run
+	old, err := c.Client.ListContainers(Label)
+	if err != nil {
+		return err
+	}
+	for _, ct := range old {
+		err = c.Client.RemoveContainer(ct.ID, true)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+
+	mode := c.Network
+	if mode == "" || mode == "host" {
+		mode = "host"
+	} else {
+		c.network, err = c.Client.CreateNetwork(c.Network, map[string]string{Label: "network"})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Start the register replicas and wait for each one
+	for i, addr := range c.replicas() {
+		conf := ContainerConfig{Image: RegisterImage, HostConfig: HostConfig{NetworkMode: mode}}
+		err = c.run(c.registerName(i), conf, map[string]string{"REPLICA": strconv.Itoa(i)})
+		if err == nil {
+			err = c.waitRegister(addr, 30*time.Second)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mode = mode
+	for i := 1; i <= c.Peers; i++ {
+		err = c.StartPeer(fmt.Sprintf("peer-%d", i), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartPeer start another peer container, env is added to the configuration of the cluster
+func (c *Cluster) StartPeer(name string, env map[string]string) error {
+	var binds []string
+	if c.Logs != "" {
+		logs, err := filepath.Abs(c.Logs)
+		if err != nil {
+			return err
+		}
+		binds = append(binds, logs+":/peer/logs")
+	}
+	conf := ContainerConfig{Image: PeerImage, HostConfig: HostConfig{NetworkMode: c.mode, Binds: binds}}
+	return c.run(name, conf, env)
+}
+
+// RestartRegister kill the container of a register replica and start it again. The container keeps its
+// file system, so the register restores its state from the file
+func (c *Cluster) RestartRegister(replica int) error {
+	addrs := c.replicas()
+	if c.Gossip {
+		return errors.New("no register service with gossip discovery")
+	}
+	if replica < 0 || replica >= len(addrs) {
+		return fmt.Errorf("register replica %d not found", replica)
+	}
+	name := c.registerName(replica)
+	c.mu.Lock()
+	id, ok := c.containers[name]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("container %s not found", name)
+	}
+	err := c.Client.KillContainer(id, "SIGKILL")
+	if err != nil {
+		return err
+	}
+
+	// The container can be still stopping after the kill
+	since := time.Now()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		err = c.Client.StartContainer(id)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("start register: %w", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	go c.follow(name, id, since)
+	return c.waitRegister(addrs[replica], 10*time.Second)
+}
+
+// Kill a container with SIGKILL, simulating the crash of the host
+func (c *Cluster) Kill(name string) error {
+	c.mu.Lock()
+	id, ok := c.containers[name]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("container %s not found", name)
+	}
+	return c.Client.KillContainer(id, "SIGKILL")
+}
+
+// Stop and remove the containers and the network of the run. The containers are killed with SIGKILL by the
+// forced removal: on SIGTERM the peers would leave the network gracefully, and the checker would not count
+// them as surviving
+func (c *Cluster) Stop() {
+	c.mu.Lock()
+	containers := c.containers
+	c.containers = nil
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for name, id := range containers {
+		wg.Add(1)
+		go func(name, id string) {
+			defer wg.Done()
+			err := c.Client.RemoveContainer(id, true)
+			if err != nil && !IsNotFound(err) {
+				log.Println("Remove container", name, "error:", err)
+			}
+		}(name, id)
+	}
+	wg.Wait()
+
+	if c.network != "" {
+		err := c.Client.RemoveNetwork(c.network)
+		if err != nil {
+			log.Println("Remove network error:", err)
+		}
+		c.network = ""
+	}
+}
+
+// Wait until a register replica is listening on addr
+func (c *Cluster) waitRegister(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("register service not listening on %s: %w", addr, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Return the addresses of the register replicas, none with gossip discovery
+func (c *Cluster) replicas() []string {
+	if c.Gossip {
+		return nil
+	}
+	return strings.Split(c.Register, ",")
+}
+
+// Name of the container of a register replica, "register" if there is only one
+func (c *Cluster) registerName(replica int) string {
+	if len(c.replicas()) == 1 {
+		return "register"
+	}
+	return fmt.Sprintf("register-%d", replica)
+}
+
+// Create and start a container with additional environment variables, then follow its output
+func (c *Cluster) run(name string, conf ContainerConfig, env map[string]string) error {
+	vars := make(map[string]string)
+	for k, v := range c.Env {
+		vars[k] = v
+	}
+	for k, v := range env {
+		vars[k] = v
+	}
+	for k, v := range vars {
+		conf.Env = append(conf.Env, k+"="+v)
+	}
+	conf.Labels = map[string]string{Label: name}
+
+	id, err := c.Client.CreateContainer("election-"+name, conf)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", name, err)
+	}
+	c.mu.Lock()
+	c.containers[name] = id
+	c.mu.Unlock()
+
+	err = c.Client.StartContainer(id)
+	if err != nil {
+		return fmt.Errorf("start %s: %w", name, err)
+	}
+	go c.follow(name, id, time.Time{})
+	return nil
+}
+
+// Copy the output of a container since the given time, prefixing each line with its name
+func (c *Cluster) follow(name, id string, since time.Time) {
+	err := c.Client.Logs(id, since, func(line string) {
+		c.out.Lock()
+		fmt.Fprintf(c.Out, "%-10s | %s\n", name, line)
+		c.out.Unlock()
+	})
+	if err != nil {
+		log.Println("Logs of", name, "error:", err)
+	}
+}
+
+// Write a tar archive of a directory, the git metadata and the event logs are skipped
+func archive(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() && (d.Name() == ".git" || rel == "Code/logs") {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() && !d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		h, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		h.Name = rel
+		err = tw.WriteHeader(h)
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tw.Close()
+	return buf.Bytes(), err
+}
@@ -0,0 +1,273 @@
+package Events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"prog/Utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log level
+const (
+	ERROR = iota
+	INFO
+	DEBUG
+	TRACE
+)
+
+// Names of the log levels
+var levelNames = []string{"error", "info", "debug", "trace"}
+
+// Event type
+const (
+	START       = "start"       // The peer started and registered on the network
+	SEND        = "send"        // The peer sent a message
+	SEND_FAIL   = "send_fail"   // The peer could not deliver a message
+	RECEIVE     = "receive"     // The peer received a message
+	DELAY       = "delay"       // The peer generated a random delay
+	ELECTION    = "election"    // The peer started an election
+	JOIN        = "join"        // The peer joined an election started by another peer
+	EXIT        = "exit"        // The peer exited an election (Bully)
+	COORDINATOR = "coordinator" // The peer recognized a coordinator
+	ALIVE       = "alive"       // The peer knows that another peer is alive
+	FAILURE     = "failure"     // The peer knows that another peer is down
+	HEARTBEAT   = "heartbeat"   // The peer started the heartbeat service
+	CRASH       = "crash"       // The peer is crashing
+	RESTART     = "restart"     // The peer restarted after a crash and rejoined the network
+	LEAVE       = "leave"       // The peer left the network gracefully
+	TRANSFER    = "transfer"    // The peer started the election of a leadership transfer
+	PAUSE       = "pause"       // The peer has been paused
+	PARTITION   = "partition"   // The peer started dropping messages to or from other peers
+	HEAL        = "heal"        // The peer stopped dropping messages
+	RELOAD      = "reload"      // The peer applied a new configuration
+	DUPLICATE   = "duplicate"   // A message has been duplicated by the network or discarded as duplicate
+	REORDER     = "reorder"     // A message has been delayed so that it can be delivered out of order
+	LOG         = "log"         // Generic message
+)
+
+// Event struct, serialized as a JSON line
+type Event struct {
+	Time    time.Time `json:"time"`
+	Peer    int       `json:"peer"`
+	Level   string    `json:"level"`
+	Type    string    `json:"type"`
+	Msg     string    `json:"msg,omitempty"` // Type of the message (ELECTION, OK, COORDINATOR, HEARTBEAT)
+	From    int       `json:"from"`          // Sender of the message, -1 if not applicable
+	To      int       `json:"to"`            // Receiver of the message, -1 if not applicable
+	Term    int       `json:"term"`          // Election term known by the peer
+	Lamport int       `json:"lamport"`       // Lamport timestamp of the event
+	Vector  []int     `json:"vector,omitempty"`
+	Delay   int       `json:"delay,omitempty"`
+	Text    string    `json:"text,omitempty"`
+}
+
+var mu sync.Mutex      // Protect the logger state
+var level = INFO       // Configured level
+var peer = -1          // ID of the peer that writes the events
+var term = 0           // Election term known by the peer
+var clock *Utils.Clock // Logical clocks of the peer
+var file *os.File      // File where the events are written
+var enc *json.Encoder  // JSON encoder of file
+
+// New return an event of type typ that does not refer to a message
+func New(typ string) Event {
+	return Event{Type: typ, From: -1, To: -1}
+}
+
+// Message return an event of type typ about a message exchanged between from and to
+func Message(typ string, msg string, from, to int) Event {
+	return Event{Type: typ, Msg: msg, From: from, To: to}
+}
+
+// ParseLevel return the level with the given name
+func ParseLevel(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return INFO, nil
+	}
+	for i, n := range levelNames {
+		if n == s {
+			return i, nil
+		}
+	}
+	return INFO, fmt.Errorf("unknown log level %q (select error, info, debug or trace)", s)
+}
+
+// LevelName return the name of a level
+func LevelName(l int) string {
+	if l < ERROR || l > TRACE {
+		return "level" + strconv.Itoa(l)
+	}
+	return levelNames[l]
+}
+
+// SetLevel set the level of the events to log
+func SetLevel(l int) {
+	mu.Lock()
+	level = l
+	mu.Unlock()
+}
+
+// SetTerm set the election term added to the next events
+func SetTerm(t int) {
+	mu.Lock()
+	term = t
+	mu.Unlock()
+}
+
+// SetClock set the logical clocks used to timestamp events that do not carry a timestamp
+func SetClock(c *Utils.Clock) {
+	mu.Lock()
+	clock = c
+	mu.Unlock()
+}
+
+// Open the event log of peer id in dir. Until Open is called events are only printed in the command line.
+// The log is truncated on a fresh start, a peer that rejoins appends to it so the events before the restart
+// are kept
+func Open(dir string, id int, rejoin bool) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if rejoin {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "peer_"+strconv.Itoa(id)+".jsonl"), flag, 0644)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	peer = id
+	file = f
+	enc = json.NewEncoder(f)
+	return nil
+}
+
+// Close the event log
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return nil
+	}
+	err := file.Close()
+	file = nil
+	enc = nil
+	return err
+}
+
+// Log write the event if its level is enabled. The arguments are printed in the command line
+// and stored in the text of the event
+func Log(l int, e Event, a ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l > level {
+		return
+	}
+
+	// Complete the event
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Peer = peer
+	e.Term = term
+	e.Level = LevelName(l)
+	if e.Vector == nil && clock != nil {
+		e.Lamport, e.Vector = clock.Now()
+	}
+	if len(a) > 0 {
+		e.Text = strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+		log.Println(a...)
+	}
+
+	// Write the JSON line
+	if enc != nil {
+		err := enc.Encode(e)
+		if err != nil {
+			log.Println("Write event error:", err)
+		}
+	}
+}
+
+// Error log an event with ERROR level
+func Error(e Event, a ...any) {
+	Log(ERROR, e, a...)
+}
+
+// Info log an event with INFO level
+func Info(e Event, a ...any) {
+	Log(INFO, e, a...)
+}
+
+// Debug log an event with DEBUG level
+func Debug(e Event, a ...any) {
+	Log(DEBUG, e, a...)
+}
+
+// Trace log an event with TRACE level
+func Trace(e Event, a ...any) {
+	Log(TRACE, e, a...)
+}
+
+// Read the events written in r
+func Read(r io.Reader) ([]Event, error) {
+	var events []Event
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var e Event
+		err := json.Unmarshal(sc.Bytes(), &e)
+		if err != nil {
+			return events, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, sc.Err()
+}
+
+// ReadDir read the event logs of all peers in dir and return the events sorted by time
+func ReadDir(dir string) ([]Event, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no event log in %s", dir)
+	}
+
+	var events []Event
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		ev, err := Read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		events = append(events, ev...)
+	}
+
+	// Merge the logs by time
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events, nil
+}
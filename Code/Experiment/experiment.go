@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"prog/Checker"
+	"prog/Config"
+	"prog/Events"
+	"prog/Faults"
+	"prog/Local"
+	"prog/Scenario"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configuration of the network in a run
+type config struct {
+	algorithm string
+	peers     int
+	delay     int
+	heartbeat int
+}
+
+// Result of a run
+type result struct {
+	config
+	seed       int64
+	elections  []time.Duration // Duration of each completed election
+	messages   int             // Messages sent, heartbeats excluded
+	heartbeats int             // HEARTBEAT messages sent
+	failures   int             // Failures detected for peers that did not crash
+	passed     bool            // If true all properties of the checker hold
+}
+
+func main() {
+
+	// Set application flags
+	aFlag := flag.String("a", "bully,ring", "Comma-separated election algorithms")
+	nFlag := flag.String("n", "4", "Comma-separated numbers of peers")
+	dFlag := flag.String("d", "200", "Comma-separated maximum delays in ms (main parameter of the delay model)")
+	dmFlag := flag.String("dm", "uniform", "Delay model (select constant, uniform, exponential, normal or pareto)")
+	hbFlag := flag.String("hb", "2", "Comma-separated durations of the heartbeat service shift in seconds")
+	kFlag := flag.Int("k", 3, "Number of runs of each configuration, each with a different seed")
+	seedFlag := flag.Int64("seed", 1, "Seed of the first run")
+	durFlag := flag.Duration("duration", 20*time.Second, "Duration of each run")
+	sFlag := flag.String("scenario", "", "JSON file with the scenario of each run (crashes and faults)")
+	oFlag := flag.String("o", "runs.csv", "Output CSV file with the result of each run")
+	sumFlag := flag.String("summary", "", "Output CSV file with the statistics of each configuration "+
+		"(default only printed)")
+
+	// Retrieve flags value
+	flag.Parse()
+
+	// Build the sweep
+	var configs []config
+	ns, err := ints(*nFlag)
+	if err != nil {
+		log.Fatalln("Peers error:", err)
+	}
+	ds, err := ints(*dFlag)
+	if err != nil {
+		log.Fatalln("Delay error:", err)
+	}
+	hbs, err := ints(*hbFlag)
+	if err != nil {
+		log.Fatalln("Heartbeat error:", err)
+	}
+	for _, a := range strings.Split(*aFlag, ",") {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a != "bully" && a != "ring" {
+			log.Fatalln("Unknown algorithm", a)
+		}
+		for _, n := range ns {
+			for _, d := range ds {
+				for _, hb := range hbs {
+					configs = append(configs, config{algorithm: a, peers: n, delay: d, heartbeat: hb})
+				}
+			}
+		}
+	}
+
+	var scenario *Scenario.Scenario
+	if *sFlag != "" {
+		scenario, err = Scenario.Load(*sFlag)
+		if err != nil {
+			log.Fatalln("Load scenario error:", err)
+		}
+	}
+
+	// Read the configuration, the config file is copied in each run
+	conf, err := Config.Load("config.json")
+	if err != nil {
+		log.Fatalln("Configuration error:", err)
+	}
+	j, err := os.ReadFile("config.json")
+	if err != nil {
+		log.Fatalln("Open config file error:", err)
+	}
+
+	// Build the binaries once
+	bin, err := os.MkdirTemp("", "experiment")
+	if err != nil {
+		log.Fatalln("Create temporary directory error:", err)
+	}
+	defer os.RemoveAll(bin)
+	err = (&Local.Cluster{Bin: bin}).Build()
+	if err != nil {
+		log.Fatalln("Build error:", err)
+	}
+
+	out, err := os.Create(*oFlag)
+	if err != nil {
+		log.Fatalln("Create output error:", err)
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+	w.Write([]string{"algorithm", "peers", "delay", "heartbeat", "seed", "elections", "election_mean_ms",
+		"election_max_ms", "messages", "heartbeats", "false_detections", "passed"})
+
+	// Run each configuration K times
+	var results []result
+	total := len(configs) * *kFlag
+	for i, c := range configs {
+		for k := 0; k < *kFlag; k++ {
+			seed := *seedFlag + int64(k)
+			log.Printf("Run %d/%d: %s, %d peers, delay %dms, heartbeat %ds, seed %d", i**kFlag+k+1, total,
+				c.algorithm, c.peers, c.delay, c.heartbeat, seed)
+			r, err := run(c, seed, *dmFlag, scenario, conf, j, bin, *durFlag)
+			if err != nil {
+				log.Fatalln("Run error:", err)
+			}
+			results = append(results, r)
+			w.Write(r.record())
+			w.Flush()
+		}
+	}
+	if err := w.Error(); err != nil {
+		log.Fatalln("Write output error:", err)
+	}
+
+	// Statistics of each configuration
+	var summary io.Writer = io.Discard
+	if *sumFlag != "" {
+		f, err := os.Create(*sumFlag)
+		if err != nil {
+			log.Fatalln("Create summary error:", err)
+		}
+		defer f.Close()
+		summary = f
+	}
+	writeSummary(os.Stdout, summary, configs, results)
+}
+
+// Run a configuration with a seed and return its result
+func run(c config, seed int64, model string, s *Scenario.Scenario, conf Config.Config, confFile []byte,
+	bin string, d time.Duration) (result, error) {
+	r := result{config: c, seed: seed}
+
+	// Working directory of the run, with its configuration and event logs
+	dir, err := os.MkdirTemp("", "run")
+	if err != nil {
+		return r, err
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "logs"), 0755)
+	if err != nil {
+		return r, err
+	}
+	err = os.WriteFile(filepath.Join(dir, "config.json"), confFile, 0644)
+	if err != nil {
+		return r, err
+	}
+
+	// Set the configuration of the processes as launch.go does
+	rand.Seed(seed)
+	conf.Peers = c.peers
+	conf.Algorithm = c.algorithm
+	conf.Delay = c.delay
+	conf.DelayModel = strings.ToLower(model)
+	conf.Heartbeat = c.heartbeat
+	conf.LogLevel = Events.LevelName(Events.TRACE)
+	conf.LogDir = "logs"
+	conf.Seed = seed
+	conf.Crash = nil
+	var crash []int
+	if s != nil {
+		crash, err = s.CrashPeers(c.peers)
+		if err != nil {
+			return r, err
+		}
+		conf.Crash = crash
+		if s.Network != nil {
+			conf.Network = *s.Network
+		}
+	}
+	err = conf.Validate()
+	if err != nil {
+		return r, err
+	}
+	env := conf.Env()
+
+	// The output of the processes is kept in the run directory only
+	output, err := os.Create(filepath.Join(dir, "output.log"))
+	if err != nil {
+		return r, err
+	}
+	defer output.Close()
+
+	register := strings.Join(conf.RegisterAddrs(), ",")
+	cluster := &Local.Cluster{Peers: c.peers, Register: register, Env: env, Out: output, Dir: dir, Bin: bin}
+	err = cluster.Start()
+	if err == nil && s != nil && len(s.Faults) > 0 {
+		in := Faults.Injector{Register: register, Peers: c.peers}
+		stop := make(chan struct{})
+		defer close(stop)
+		go in.Run(s.Faults, stop)
+	}
+	if err == nil {
+		time.Sleep(d)
+	}
+	cluster.Stop()
+	if err != nil {
+		return r, err
+	}
+
+	events, err := Events.ReadDir(filepath.Join(dir, "logs"))
+	if err != nil {
+		return r, err
+	}
+	opt := Checker.Options{Peers: c.peers}
+	if s != nil {
+		opt.MaxLatency = time.Duration(s.Expect.MaxLatency)
+	}
+	report := Checker.Check(events, opt)
+	if s != nil {
+		s.Verify(&report, crash, events)
+	}
+	r.elections = report.Elections
+	r.passed = report.Passed
+	r.messages, r.heartbeats = messages(events)
+	r.failures = falseDetections(events)
+	return r, nil
+}
+
+// Count the messages sent, heartbeats apart
+func messages(events []Events.Event) (int, int) {
+	msgs, hbs := 0, 0
+	for _, e := range events {
+		if e.Type != Events.SEND {
+			continue
+		}
+		if e.Msg == "HEARTBEAT" {
+			hbs++
+		} else {
+			msgs++
+		}
+	}
+	return msgs, hbs
+}
+
+// Count the failures detected for peers that had not crashed, events are sorted by time
+func falseDetections(events []Events.Event) int {
+	crashed := make(map[int]bool)
+	n := 0
+	for _, e := range events {
+		switch e.Type {
+		case Events.CRASH:
+			crashed[e.Peer] = true
+		case Events.FAILURE:
+			if !crashed[e.From] {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Return the CSV record of a run
+func (r result) record() []string {
+	mean, max := 0.0, 0.0
+	if len(r.elections) > 0 {
+		ms := millis(r.elections)
+		mean, max = average(ms), ms[len(ms)-1]
+	}
+	return []string{r.algorithm, strconv.Itoa(r.peers), strconv.Itoa(r.delay), strconv.Itoa(r.heartbeat),
+		strconv.FormatInt(r.seed, 10), strconv.Itoa(len(r.elections)), format(mean), format(max),
+		strconv.Itoa(r.messages), strconv.Itoa(r.heartbeats), strconv.Itoa(r.failures), strconv.FormatBool(r.passed)}
+}
+
+// Write the statistics of each configuration as a table on out and as CSV on w
+func writeSummary(out, w io.Writer, configs []config, results []result) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"algorithm", "peers", "delay", "heartbeat", "runs", "passed", "elections",
+		"election_mean_ms", "election_p50_ms", "election_p99_ms", "messages_mean", "false_detections"})
+	fmt.Fprintf(out, "%-6s %5s %6s %3s %5s %7s %10s %10s %10s %9s %6s\n", "ALGO", "PEERS", "DELAY", "HB",
+		"RUNS", "PASSED", "MEAN(ms)", "P50(ms)", "P99(ms)", "MESSAGES", "FALSE")
+
+	for _, c := range configs {
+		var durations []time.Duration
+		runs, passed, msgs, failures := 0, 0, 0, 0
+		for _, r := range results {
+			if r.config != c {
+				continue
+			}
+			runs++
+			if r.passed {
+				passed++
+			}
+			durations = append(durations, r.elections...)
+			msgs += r.messages
+			failures += r.failures
+		}
+		if runs == 0 {
+			continue
+		}
+		ms := millis(durations)
+		mean, p50, p99 := average(ms), percentile(ms, 50), percentile(ms, 99)
+		msgMean := float64(msgs) / float64(runs)
+
+		cw.Write([]string{c.algorithm, strconv.Itoa(c.peers), strconv.Itoa(c.delay), strconv.Itoa(c.heartbeat),
+			strconv.Itoa(runs), strconv.Itoa(passed), strconv.Itoa(len(ms)), format(mean), format(p50), format(p99),
+			format(msgMean), strconv.Itoa(failures)})
+		fmt.Fprintf(out, "%-6s %5d %6d %3d %5d %7d %10.1f %10.1f %10.1f %9.1f %6d\n", c.algorithm, c.peers,
+			c.delay, c.heartbeat, runs, passed, mean, p50, p99, msgMean, failures)
+	}
+	cw.Flush()
+}
+
+// Parse a comma-separated list of integers
+func ints(s string) ([]int, error) {
+	var list []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// Return the durations in ms, sorted
+func millis(d []time.Duration) []float64 {
+	ms := make([]float64, len(d))
+	for i, v := range d {
+		ms[i] = float64(v) / float64(time.Millisecond)
+	}
+	sort.Float64s(ms)
+	return ms
+}
+
+// Return the mean of the values, 0 if there are none
+func average(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// Return the p-th percentile of sorted values with the nearest-rank method, 0 if there are none
+func percentile(v []float64, p float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(v)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return v[i]
+}
+
+// Format a float for the CSV files
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
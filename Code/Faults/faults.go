@@ -0,0 +1,478 @@
+package Faults
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"prog/Utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault action
+const (
+	CRASH            = "crash"            // Make the peer exit
+	PAUSE            = "pause"            // Make the peer unresponsive for a duration
+	PARTITION        = "partition"        // Split the network in groups that cannot communicate
+	BLOCK            = "block"            // Drop the messages from a set of peers to another one (one-way partition)
+	HEAL             = "heal"             // Remove all partitions
+	RESTART          = "restart"          // Start a new process for a crashed peer, it rejoins with the same ID
+	RESTART_REGISTER = "restart-register" // Kill the register service and start it again, it restores its state
+	LEAVE            = "leave"            // Make the peer leave the network gracefully
+	TRANSFER         = "transfer"         // Make the coordinator hand the leadership to the peer
+)
+
+// Special targets of a fault
+const (
+	LEADER = "leader" // The coordinator known by the majority of live peers
+)
+
+// Duration that can be written in JSON as a string ("5s", "300ms") or as a number of milliseconds
+type Duration time.Duration
+
+// UnmarshalJSON parse a duration
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v any
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	switch x := v.(type) {
+	case float64:
+		*d = Duration(time.Duration(x) * time.Millisecond)
+	case string:
+		t, err := time.ParseDuration(x)
+		if err != nil {
+			return err
+		}
+		*d = Duration(t)
+	default:
+		return fmt.Errorf("invalid duration %s", string(b))
+	}
+	return nil
+}
+
+// MarshalJSON write a duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Fault struct, a fault of the schedule
+type Fault struct {
+	At       Duration `json:"at,omitempty"`       // Time from the start of the run, or from the trigger if On is set
+	On       string   `json:"on,omitempty"`       // Event that triggers the fault: "election:N" (the N-th election starts)
+	Action   string   `json:"action"`             // Action to apply: crash, pause, restart...
+	Peer     string   `json:"peer,omitempty"`     // Target of crash, pause, restart, leave and transfer: peer ID or "leader"
+	Duration Duration `json:"duration,omitempty"` // Duration of a pause
+	Groups   [][]int  `json:"groups,omitempty"`   // Groups of a partition
+	From     []int    `json:"from,omitempty"`     // Senders whose messages are dropped by block
+	To       []int    `json:"to,omitempty"`       // Receivers of the messages dropped by block
+	Replica  int      `json:"replica,omitempty"`  // Register replica of restart-register
+}
+
+// Schedule list of faults to inject during a run
+type Schedule []Fault
+
+// Load read a schedule from a JSON file
+func Load(path string) (Schedule, error) {
+	j, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Schedule
+	err = json.Unmarshal(j, &s)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.Validate()
+}
+
+// Validate check the faults of the schedule
+func (s Schedule) Validate() error {
+	for i, f := range s {
+		if f.On != "" {
+			if _, err := electionTrigger(f.On); err != nil {
+				return fmt.Errorf("fault %d: %w", i, err)
+			}
+		}
+		switch f.Action {
+		case CRASH, RESTART, LEAVE, TRANSFER:
+		case PAUSE:
+			if f.Duration <= 0 {
+				return fmt.Errorf("fault %d: pause requires a positive duration", i)
+			}
+		case PARTITION:
+			if len(f.Groups) < 2 {
+				return fmt.Errorf("fault %d: partition requires at least two groups", i)
+			}
+			continue
+		case BLOCK:
+			if len(f.From) == 0 || len(f.To) == 0 {
+				return fmt.Errorf("fault %d: block requires from and to peers", i)
+			}
+			continue
+		case HEAL, RESTART_REGISTER:
+			continue
+		default:
+			return fmt.Errorf("fault %d: unknown action %q", i, f.Action)
+		}
+		if f.Peer != LEADER {
+			if _, err := strconv.Atoi(f.Peer); err != nil {
+				return fmt.Errorf("fault %d: invalid peer %q (select a peer ID or \"leader\")", i, f.Peer)
+			}
+		}
+	}
+	return nil
+}
+
+// Parse an "election:N" trigger
+func electionTrigger(on string) (int, error) {
+	if !strings.HasPrefix(on, "election:") {
+		return 0, fmt.Errorf("unknown trigger %q (select \"election:N\")", on)
+	}
+	i, err := strconv.Atoi(strings.TrimPrefix(on, "election:"))
+	if err != nil || i <= 0 {
+		return 0, fmt.Errorf("invalid election number in %q", on)
+	}
+	return i, nil
+}
+
+// Injector applies a schedule to the peers of a network through their control endpoints
+type Injector struct {
+	Register string        // Address of the register service, or comma separated addresses of its replicas
+	Peers    int           // Number of peers in the network
+	Poll     time.Duration // Interval between two polls of the peers status
+
+	Restart         func(id int) error      // Start a new process for a crashed peer, nil if not supported
+	RestartRegister func(replica int) error // Restart a register replica, nil if not supported
+
+	mu        sync.Mutex
+	peers     []Utils.Peer         // Peers registered on the network
+	status    map[int]Utils.Status // Last status of the live peers
+	elections int                  // Number of elections observed
+	sum       int                  // Sum of the elections started by the peers in the last poll
+	agreed    bool                 // If true the live peers agreed on the coordinator in the last poll
+}
+
+// Run apply the schedule, it returns when all faults have been applied or stop is closed
+func (in *Injector) Run(s Schedule, stop <-chan struct{}) error {
+	if in.Poll == 0 {
+		in.Poll = 100 * time.Millisecond
+	}
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+
+	// Wait for all peers to register, the run starts when the network is complete
+	err = in.waitPeers(stop)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	log.Println("Fault injector started with", len(s), "faults.")
+
+	// Time at which each triggered fault has been armed
+	armed := make([]time.Time, len(s))
+	done := make([]bool, len(s))
+	remaining := len(s)
+
+	ticker := time.NewTicker(in.Poll)
+	defer ticker.Stop()
+	for remaining > 0 {
+		in.poll()
+
+		for i, f := range s {
+			if done[i] {
+				continue
+			}
+
+			// Arm the fault when its trigger happens
+			if armed[i].IsZero() {
+				if f.On == "" {
+					armed[i] = start
+				} else {
+					n, err := electionTrigger(f.On)
+					if err != nil {
+						return fmt.Errorf("fault %d: %w", i, err)
+					}
+					if in.Elections() < n {
+						continue
+					}
+					armed[i] = time.Now()
+				}
+			}
+
+			// Apply the fault when its time has come
+			if time.Since(armed[i]) >= time.Duration(f.At) {
+				err := in.Apply(f)
+				if err != nil {
+					log.Println("Fault injection error:", err)
+				}
+				done[i] = true
+				remaining--
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Apply a fault immediately
+func (in *Injector) Apply(f Fault) error {
+	in.mu.Lock()
+	peers := in.peers
+	in.mu.Unlock()
+
+	// Faults that involve all peers
+	switch f.Action {
+	case PARTITION:
+		log.Println("Fault injector: partition", f.Groups)
+		return Partition(peers, f.Groups)
+	case BLOCK:
+		log.Println("Fault injector: drop messages from", f.From, "to", f.To)
+		return Block(peers, f.From, f.To)
+	case HEAL:
+		log.Println("Fault injector: heal partitions")
+		return Heal(peers)
+	case RESTART_REGISTER:
+		if in.RestartRegister == nil {
+			return errors.New("restart of the register service not supported")
+		}
+		log.Println("Fault injector: restart the register replica", f.Replica)
+		return in.RestartRegister(f.Replica)
+	}
+
+	p, err := in.target(f.Peer)
+	if err != nil {
+		return err
+	}
+
+	switch f.Action {
+	case CRASH:
+		log.Println("Fault injector: crash peer", p.ID)
+		return Call(p, "Control.Crash", 0)
+	case LEAVE:
+		log.Println("Fault injector: peer", p.ID, "leaves the network")
+		return Call(p, "Control.Leave", 0)
+	case TRANSFER:
+		c, err := in.target(LEADER)
+		if err != nil {
+			return errors.New("no coordinator to transfer the leadership from")
+		}
+		log.Println("Fault injector: coordinator", c.ID, "hands the leadership to peer", p.ID)
+		return Call(c, "Control.Transfer", &p.ID)
+	case PAUSE:
+		log.Println("Fault injector: pause peer", p.ID, "for", time.Duration(f.Duration))
+		d := time.Duration(f.Duration)
+		return Call(p, "Control.Pause", &d)
+	case RESTART:
+		if in.Restart == nil {
+			return errors.New("restart not supported")
+		}
+		log.Println("Fault injector: restart peer", p.ID)
+		return in.Restart(p.ID)
+	}
+	return fmt.Errorf("unknown action %q", f.Action)
+}
+
+// Elections return the number of elections observed so far
+func (in *Injector) Elections() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.elections
+}
+
+// Leader return the live coordinator known by the majority of live peers, -1 if unknown
+func (in *Injector) Leader() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	votes := make(map[int]int)
+	for _, st := range in.status {
+		if _, live := in.status[st.Coordinator]; live {
+			votes[st.Coordinator]++
+		}
+	}
+	leader, max := -1, 0
+	for c, n := range votes {
+		if n > max || (n == max && c > leader) {
+			leader, max = c, n
+		}
+	}
+	return leader
+}
+
+// Resolve the target of a fault
+func (in *Injector) target(peer string) (Utils.Peer, error) {
+	id := -1
+	if peer == LEADER {
+		id = in.Leader()
+	} else {
+		id, _ = strconv.Atoi(peer)
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, p := range in.peers {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Utils.Peer{}, fmt.Errorf("peer %s not found", peer)
+}
+
+// Wait until all peers are registered on the register service
+func (in *Injector) waitPeers(stop <-chan struct{}) error {
+	for {
+		var peers []Utils.Peer
+		cli, err := Utils.DialRegister(in.Register)
+		if err == nil {
+			err = cli.Call("Register.GetPeers", 0, &peers)
+			cli.Close()
+		}
+		if err == nil && len(peers) >= in.Peers {
+			sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+			in.mu.Lock()
+			in.peers = peers
+			in.mu.Unlock()
+			return nil
+		}
+
+		select {
+		case <-stop:
+			return errors.New("fault injector stopped")
+		case <-time.After(in.Poll):
+		}
+	}
+}
+
+// Poll the status of the peers and count the elections. A new election is counted when the number of
+// elections started by the peers grows after the live peers agreed on the coordinator
+func (in *Injector) poll() {
+	in.mu.Lock()
+	peers := in.peers
+	in.mu.Unlock()
+
+	status := make(map[int]Utils.Status)
+	for _, p := range peers {
+		st, err := GetStatus(p)
+		if err == nil {
+			status[p.ID] = st
+		}
+	}
+
+	sum := 0
+	agreed := true
+	coordinator := -2
+	for _, st := range status {
+		sum += st.Elections
+		if st.Election || (coordinator != -2 && st.Coordinator != coordinator) {
+			agreed = false
+		}
+		coordinator = st.Coordinator
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if sum > in.sum && (in.agreed || in.elections == 0) {
+		in.elections++
+	}
+	in.sum = sum
+	in.agreed = agreed
+	in.status = status
+}
+
+// Partition split the peers in groups, the messages between different groups are dropped
+func Partition(peers []Utils.Peer, groups [][]int) error {
+	for i := range groups {
+		for j := range groups {
+			if i == j {
+				continue
+			}
+			err := Block(peers, groups[i], groups[j])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Block drop the messages sent by the peers in from to the peers in to. Unreachable peers are skipped
+// and the first error is returned
+func Block(peers []Utils.Peer, from, to []int) error {
+	var first error
+	for _, p := range peers {
+		var b Utils.Block
+		if contains(from, p.ID) {
+			b.To = to
+		}
+		if contains(to, p.ID) {
+			b.From = from
+		}
+		if b.To == nil && b.From == nil {
+			continue
+		}
+		err := Call(p, "Control.Block", &b)
+		if err != nil && first == nil {
+			first = fmt.Errorf("peer %d: %w", p.ID, err)
+		}
+	}
+	return first
+}
+
+// Heal remove all partitions
+func Heal(peers []Utils.Peer) error {
+	var first error
+	for _, p := range peers {
+		err := Call(p, "Control.Heal", 0)
+		if err != nil && first == nil {
+			first = fmt.Errorf("peer %d: %w", p.ID, err)
+		}
+	}
+	return first
+}
+
+// Call a control method of a peer that returns a boolean
+func Call(p Utils.Peer, method string, args any) error {
+	cli, err := rpc.DialHTTP("tcp", p.IP+":"+p.Port)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	var ok bool
+	return cli.Call(method, args, &ok)
+}
+
+// Search an int from a slice of int
+func contains(slice []int, id int) bool {
+	for _, v := range slice {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStatus return the status of a peer
+func GetStatus(p Utils.Peer) (Utils.Status, error) {
+	var st Utils.Status
+	cli, err := rpc.DialHTTP("tcp", p.IP+":"+p.Port)
+	if err != nil {
+		return st, err
+	}
+	defer cli.Close()
+	err = cli.Call("Control.Status", 0, &st)
+	return st, err
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package Local
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Run the process in its own process group, so it doesn't receive the Ctrl-C of the terminal
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,11 @@
+package Local
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Run the process in its own process group, so it doesn't receive the Ctrl-C of the console
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
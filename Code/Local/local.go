@@ -0,0 +1,274 @@
+package Local
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cluster of a register and peer processes running on the local machine. The processes run in Dir, where
+// they read the config.json file and write the event logs, the environment overrides the file
+type Cluster struct {
+	Peers    int               // Number of peer processes
+	Register string            // Address of the register, or comma separated addresses of its replicas
+	Gossip   bool              // If true the peers join with gossip discovery, Register is the list of seeds
+	Env      map[string]string // Configuration passed to the processes as environment variables
+	Out      io.Writer         // Output of the processes, each line prefixed with the process name
+	Dir      string            // Working directory of the processes, if empty the current one
+	Bin      string            // Directory with the binaries, if empty Build creates a temporary one
+
+	temp bool // If true Bin is a temporary directory removed by Stop
+	mu   sync.Mutex
+	cmds map[string]*process // Process name -> process
+	out  sync.Mutex          // Serialize the lines written on Out
+}
+
+// Process of the cluster
+type process struct {
+	cmd    *exec.Cmd
+	copied chan struct{} // Closed when all the output of the process is copied
+}
+
+// Wait for the process to exit, after its output is copied as os/exec requires
+func (p *process) wait() error {
+	<-p.copied
+	return p.cmd.Wait()
+}
+
+// Build compile the peer and register binaries once in Bin
+func (c *Cluster) Build() error {
+	if c.Bin == "" {
+		dir, err := os.MkdirTemp("", "election")
+		if err != nil {
+			return err
+		}
+		c.Bin, c.temp = dir, true
+	}
+	bin, err := filepath.Abs(c.Bin)
+	if err != nil {
+		return err
+	}
+	c.Bin = bin
+	for _, pkg := range []string{"Peer", "Register"} {
+		log.Println("Building", pkg, "binary.")
+		cmd := exec.Command("go", "build", "-o", c.binary(pkg), "./"+pkg)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+		if err != nil {
+			return fmt.Errorf("build %s: %w", pkg, err)
+		}
+	}
+	return nil
+}
+
+// Start the register, wait until it's listening, then start the peers. With gossip discovery only the peers
+// are started
+func (c *Cluster) Start() error {
+	if c.Out == nil {
+		c.Out = os.Stdout
+	}
+	c.mu.Lock()
+	c.cmds = make(map[string]*process)
+	c.mu.Unlock()
+	for i, addr := range c.replicas() {
+		err := c.spawn(c.registerName(i), "Register", map[string]string{"REPLICA": strconv.Itoa(i)})
+		if err == nil {
+			err = c.waitRegister(addr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 1; i <= c.Peers; i++ {
+		err := c.spawn(fmt.Sprintf("peer-%d", i), "Peer", nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartPeer start another peer process, env is added to the configuration of the cluster
+func (c *Cluster) StartPeer(name string, env map[string]string) error {
+	return c.spawn(name, "Peer", env)
+}
+
+// RestartRegister kill the process of a register replica and start a new one, it restores its state
+func (c *Cluster) RestartRegister(replica int) error {
+	addrs := c.replicas()
+	if c.Gossip {
+		return errors.New("no register service with gossip discovery")
+	}
+	if replica < 0 || replica >= len(addrs) {
+		return fmt.Errorf("register replica %d not found", replica)
+	}
+	name := c.registerName(replica)
+	c.mu.Lock()
+	p, ok := c.cmds[name]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("process %s not found", name)
+	}
+	p.cmd.Process.Kill()
+	p.wait()
+	err := c.spawn(name, "Register", map[string]string{"REPLICA": strconv.Itoa(replica)})
+	if err != nil {
+		return err
+	}
+	return c.waitRegister(addrs[replica])
+}
+
+// Kill a process, simulating the crash of the host
+func (c *Cluster) Kill(name string) error {
+	c.mu.Lock()
+	p, ok := c.cmds[name]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("process %s not found", name)
+	}
+	return p.cmd.Process.Kill()
+}
+
+// Stop interrupt the processes, kill the ones still running after a second and remove the temporary binaries
+func (c *Cluster) Stop() {
+	c.mu.Lock()
+	cmds := c.cmds
+	c.cmds = nil
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range cmds {
+		wg.Add(1)
+		go func(p *process) {
+			defer wg.Done()
+			cmd := p.cmd
+			done := make(chan struct{})
+			go func() {
+				p.wait()
+				close(done)
+			}()
+
+			// Windows does not support interrupts, the process is killed
+			if runtime.GOOS == "windows" || cmd.Process.Signal(os.Interrupt) != nil {
+				cmd.Process.Kill()
+			}
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				cmd.Process.Kill()
+				<-done
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if c.temp {
+		os.RemoveAll(c.Bin)
+	}
+}
+
+// Wait until a register replica is listening on addr
+func (c *Cluster) waitRegister(addr string) error {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("register service not listening on %s: %w", addr, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Return the addresses of the register replicas, none with gossip discovery
+func (c *Cluster) replicas() []string {
+	if c.Gossip {
+		return nil
+	}
+	return strings.Split(c.Register, ",")
+}
+
+// Name of the process of a register replica, "register" if there is only one
+func (c *Cluster) registerName(replica int) string {
+	if len(c.replicas()) == 1 {
+		return "register"
+	}
+	return fmt.Sprintf("register-%d", replica)
+}
+
+// Start a process of the cluster with additional environment variables
+func (c *Cluster) spawn(name, pkg string, env map[string]string) error {
+	cmd := exec.Command(c.binary(pkg))
+	cmd.Dir = c.Dir
+	detach(cmd)
+	cmd.Env = os.Environ()
+	for k, v := range merge(c.Env, env) {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("start %s: %w", name, err)
+	}
+	p := &process{cmd: cmd, copied: make(chan struct{})}
+	go func() {
+		c.prefix(name, stdout)
+		close(p.copied)
+	}()
+
+	c.mu.Lock()
+	c.cmds[name] = p
+	c.mu.Unlock()
+	return nil
+}
+
+// Copy the output of a process prefixing each line with its name
+func (c *Cluster) prefix(name string, r io.Reader) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		c.out.Lock()
+		fmt.Fprintf(c.Out, "%-10s | %s\n", name, s.Text())
+		c.out.Unlock()
+	}
+}
+
+// Path of the binary of a package
+func (c *Cluster) binary(pkg string) string {
+	name := pkg
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(c.Bin, name)
+}
+
+// Return the union of two maps, the values of b override the ones of a
+func merge(a, b map[string]string) map[string]string {
+	m := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,269 @@
+package Metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default buckets in seconds used by histograms
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector interface implemented by all metric types
+type collector interface {
+	write(w io.Writer)
+}
+
+var mu sync.Mutex             // Protect the registry
+var registry []collector      // Registered metrics in order of creation
+var names = map[string]bool{} // Names of the registered metrics
+
+// Counter metric, a value that can only increase
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Gauge metric, a value that can go up and down
+type Gauge struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Histogram metric, samples observations in buckets
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// histogramSeries values of a single label combination of a histogram
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewCounter create and register a new counter
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(name, c)
+	return c
+}
+
+// NewGauge create and register a new gauge
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(name, g)
+	return g
+}
+
+// NewHistogram create and register a new histogram, if buckets is nil DefBuckets are used
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &Histogram{name: name, help: help, labels: labels, buckets: b, series: make(map[string]*histogramSeries)}
+	register(name, h)
+	return h
+}
+
+// Add the metric to the registry, panic if the name is already used
+func register(name string, c collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	if names[name] {
+		panic("Metrics: duplicate metric " + name)
+	}
+	names[name] = true
+	registry = append(registry, c)
+}
+
+// Inc increment the counter by 1
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increment the counter by v, negative values are ignored
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	key := labelKey(c.name, c.labels, values)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value return the current value of the counter
+func (c *Counter) Value(values ...string) float64 {
+	key := labelKey(c.name, c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+// Set the gauge to v
+func (g *Gauge) Set(v float64, values ...string) {
+	key := labelKey(g.name, g.labels, values)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Add v to the gauge
+func (g *Gauge) Add(v float64, values ...string) {
+	key := labelKey(g.name, g.labels, values)
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Inc increment the gauge by 1
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+// Dec decrement the gauge by 1
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+// Observe add a sample to the histogram
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := labelKey(h.name, h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Handler return the HTTP handler that exposes all registered metrics in Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Write all registered metrics in Prometheus text format
+func Write(w io.Writer) {
+	mu.Lock()
+	list := append([]collector(nil), registry...)
+	mu.Unlock()
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, k, formatFloat(c.values[k]))
+	}
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, k := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, k, formatFloat(g.values[k]))
+	}
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(k, "le", formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, k, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, k, s.count)
+	}
+}
+
+// Write HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// Build the label string of a sample, e.g. {type="ELECTION"}
+func labelKey(name string, labels, values []string) string {
+	if len(labels) != len(values) {
+		panic("Metrics: wrong number of label values for " + name)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i := range labels {
+		pairs[i] = labels[i] + "=" + strconv.Quote(values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Add a label to a label string
+func withLabel(key, label, value string) string {
+	pair := label + "=" + strconv.Quote(value)
+	if key == "" {
+		return "{" + pair + "}"
+	}
+	return key[:len(key)-1] + "," + pair + "}"
+}
+
+// Return the keys of a map in sorted order
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Format a float as Prometheus expects
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,217 @@
+package Network
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"prog/Utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delay model
+const (
+	CONSTANT    = "constant"    // Always value ms
+	UNIFORM     = "uniform"     // Uniform in [min, max) ms
+	EXPONENTIAL = "exponential" // Exponential with the given mean in ms
+	NORMAL      = "normal"      // Normal with the given mean and stddev in ms, truncated at 0
+	PARETO      = "pareto"      // Pareto with the given scale (minimum) in ms and shape, long tail
+)
+
+// Model interface implemented by the delay models
+type Model interface {
+	Sample() time.Duration // Return a random delay
+	String() string
+}
+
+type constant struct{ value float64 }
+type uniform struct{ min, max float64 }
+type exponential struct{ mean float64 }
+type normal struct{ mean, stddev float64 }
+type pareto struct{ scale, shape, max float64 }
+
+func (m constant) Sample() time.Duration { return ms(m.value) }
+func (m constant) String() string        { return fmt.Sprintf("constant(%gms)", m.value) }
+
+func (m uniform) Sample() time.Duration {
+	if m.max <= m.min {
+		return ms(m.min)
+	}
+	return ms(m.min + rand.Float64()*(m.max-m.min))
+}
+func (m uniform) String() string { return fmt.Sprintf("uniform(%gms, %gms)", m.min, m.max) }
+
+func (m exponential) Sample() time.Duration { return ms(rand.ExpFloat64() * m.mean) }
+func (m exponential) String() string        { return fmt.Sprintf("exponential(mean %gms)", m.mean) }
+
+func (m normal) Sample() time.Duration { return ms(m.mean + rand.NormFloat64()*m.stddev) }
+func (m normal) String() string {
+	return fmt.Sprintf("normal(mean %gms, stddev %gms)", m.mean, m.stddev)
+}
+
+func (m pareto) Sample() time.Duration {
+	d := m.scale / math.Pow(1-rand.Float64(), 1/m.shape)
+	if m.max > 0 && d > m.max {
+		d = m.max
+	}
+	return ms(d)
+}
+func (m pareto) String() string {
+	return fmt.Sprintf("pareto(scale %gms, shape %g)", m.scale, m.shape)
+}
+
+// Convert ms to a duration, negative values are truncated at 0
+func ms(v float64) time.Duration {
+	if v <= 0 {
+		return 0
+	}
+	return time.Duration(v * float64(time.Millisecond))
+}
+
+// NewModel build a delay model from its configuration
+func NewModel(c Utils.DelayConf) (Model, error) {
+	switch strings.ToLower(c.Model) {
+	case CONSTANT:
+		return constant{c.Value}, nil
+	case UNIFORM, "":
+		if c.Max < c.Min {
+			return nil, fmt.Errorf("uniform delay: max %g is lower than min %g", c.Max, c.Min)
+		}
+		return uniform{c.Min, c.Max}, nil
+	case EXPONENTIAL:
+		if c.Mean <= 0 {
+			return nil, fmt.Errorf("exponential delay: mean must be positive")
+		}
+		return exponential{c.Mean}, nil
+	case NORMAL:
+		if c.Stddev < 0 {
+			return nil, fmt.Errorf("normal delay: stddev must not be negative")
+		}
+		return normal{c.Mean, c.Stddev}, nil
+	case PARETO:
+		if c.Scale <= 0 || c.Shape <= 0 {
+			return nil, fmt.Errorf("pareto delay: scale and shape must be positive")
+		}
+		return pareto{c.Scale, c.Shape, c.Max}, nil
+	}
+	return nil, fmt.Errorf("unknown delay model %q (select constant, uniform, exponential, normal or pareto)", c.Model)
+}
+
+// DefaultConf return the configuration of a model whose main parameter is d ms: the value of constant,
+// the maximum of uniform, the mean of exponential and normal (stddev d/4), the scale of pareto (shape 1.5)
+func DefaultConf(model string, d int) Utils.DelayConf {
+	v := float64(d)
+	switch strings.ToLower(model) {
+	case CONSTANT:
+		return Utils.DelayConf{Model: CONSTANT, Value: v}
+	case EXPONENTIAL:
+		return Utils.DelayConf{Model: EXPONENTIAL, Mean: v}
+	case NORMAL:
+		return Utils.DelayConf{Model: NORMAL, Mean: v, Stddev: v / 4}
+	case PARETO:
+		return Utils.DelayConf{Model: PARETO, Scale: v, Shape: 1.5}
+	case UNIFORM, "":
+		return Utils.DelayConf{Model: UNIFORM, Max: v}
+	}
+	return Utils.DelayConf{Model: model}
+}
+
+// link properties of the messages sent from a peer to another
+type link struct {
+	delay Model // If nil the default model
+	loss  float64
+}
+
+// Network struct, latency and loss matrix of the network and probabilities of message faults
+type Network struct {
+	mu        sync.RWMutex // Protect the configuration, it can be replaced at run time
+	def       Model
+	links     map[[2]int]link
+	drop      float64
+	duplicate float64
+	reorder   float64
+}
+
+// New build the network from the default delay model and the configuration of the links and faults
+func New(def Model, conf Utils.NetworkConf) (*Network, error) {
+	n := &Network{def: def, links: make(map[[2]int]link), drop: conf.Drop, duplicate: conf.Duplicate,
+		reorder: conf.Reorder}
+	for name, p := range map[string]float64{"drop": n.drop, "duplicate": n.duplicate, "reorder": n.reorder} {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("%s probability must be in [0, 1]", name)
+		}
+	}
+	for _, l := range conf.Links {
+		if l.Loss < 0 || l.Loss > 1 {
+			return nil, fmt.Errorf("link %d->%d: loss must be in [0, 1]", l.From, l.To)
+		}
+		var m Model
+		if l.Delay != nil {
+			var err error
+			m, err = NewModel(*l.Delay)
+			if err != nil {
+				return nil, fmt.Errorf("link %d->%d: %w", l.From, l.To, err)
+			}
+		}
+		n.links[[2]int{l.From, l.To}] = link{delay: m, loss: l.Loss}
+	}
+	return n, nil
+}
+
+// Reconfigure replace the default delay model, the links and the probabilities of message faults with the
+// ones of o, built and validated by New
+func (n *Network) Reconfigure(o *Network) {
+	n.mu.Lock()
+	n.def, n.links, n.drop, n.duplicate, n.reorder = o.def, o.links, o.drop, o.duplicate, o.reorder
+	n.mu.Unlock()
+}
+
+// Delay return a random delay for a message sent from a peer to another
+func (n *Network) Delay(from, to int) time.Duration {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if l, ok := n.links[[2]int{from, to}]; ok && l.delay != nil {
+		return l.delay.Sample()
+	}
+	return n.def.Sample()
+}
+
+// Lost check if a message sent from a peer to another is lost on the link or dropped by the network
+func (n *Network) Lost(from, to int) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if l, ok := n.links[[2]int{from, to}]; ok && l.loss > 0 && rand.Float64() < l.loss {
+		return true
+	}
+	return n.drop > 0 && rand.Float64() < n.drop
+}
+
+// Duplicate check if a message is delivered twice
+func (n *Network) Duplicate() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.duplicate > 0 && rand.Float64() < n.duplicate
+}
+
+// Reorder check if a message is delivered later than the following ones
+func (n *Network) Reorder() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.reorder > 0 && rand.Float64() < n.reorder
+}
+
+// Lossy check if messages can be lost
+func (n *Network) Lossy() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.drop > 0 {
+		return true
+	}
+	for _, l := range n.links {
+		if l.loss > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"prog/Events"
 	"prog/Utils"
 )
 
@@ -29,22 +29,25 @@ func (b Bully) sendElection() {
 		}
 
 		p := peerList[i]
-		if p.ID > ID {
+		if p.ID > ID && !hasLeft(p.ID) {
 
 			// Send message to p
-			Utils.Print(v, "Peer", ID, "sending ELECTION to", p.ID)
 			err := send([]int{ID}, Utils.ELECTION, p, &reply)
 			if err != nil {
 				// Peer offline
-				Utils.Print(v, "Peer", ID, "can't contact", p.ID)
+				Events.Debug(Events.New(Events.LOG), "Peer", ID, "can't contact", p.ID)
 				continue
 			}
 
-			// If the current peer receive an OK message, it exits the election
-			Utils.Print(v, "Peer", ID, "received OK message from", p.ID)
-			if reply.Msg == Utils.OK && election {
+			// If the current peer receive an OK message, it exits the election. A peer that defers to the
+			// target of a leadership transfer does not answer OK
+			if reply.Msg != Utils.OK {
+				continue
+			}
+			Events.Debug(Events.Message(Events.RECEIVE, "OK", p.ID, ID), "Peer", ID, "received OK message from", p.ID)
+			if election {
 				election = false
-				Utils.Print(v, "Peer", ID, "exits the election.")
+				Events.Debug(Events.New(Events.EXIT), "Peer", ID, "exits the election.")
 			}
 		}
 	}
@@ -66,18 +69,22 @@ func (r Ring) sendElection() {
 		// If the next peer on the list is the peer itself, break the loop
 		if peer.ID == ID {
 			if i == 1 {
-				Utils.Print(v, "Peer", ID, "is the only one in the ring so it's the coordinator.")
-				coordinator = ID
+				Events.Debug(Events.New(Events.LOG), "Peer", ID, "is the only one in the ring so it's the coordinator.")
+				setCoordinator(ID)
 			}
 			break
 		}
 
+		// A peer that left the network is not in the ring
+		if hasLeft(peer.ID) {
+			continue
+		}
+
 		// Send message to the peer
-		Utils.Print(v, "Peer", ID, "sending ELECTION to", peer.ID)
 		err := send(ring, Utils.ELECTION, peer, &reply)
 		if err != nil {
 			// Peer offline, try contacting the next one on the ring
-			Utils.Print(v, "Peer", ID, "can't contact", peer.ID, "try to contact next one on the ring.")
+			Events.Debug(Events.New(Events.LOG), "Peer", ID, "can't contact", peer.ID, "try to contact next one on the ring.")
 			continue
 		}
 
@@ -90,20 +97,18 @@ func (b Bully) sendCoordinator() {
 	var reply Utils.Message // Reply message
 
 	// Set coordinator as peer id
-	coordinator = ID
-	log.Println("Peer", ID, "recognized itself as COORDINATOR.")
+	setCoordinator(ID)
 
 	// Send COORDINATOR to peers
 	for i := 0; i <= len(peerList)-1; i++ {
 		p := peerList[i]
-		if p.ID != ID {
-			Utils.Print(v, "Peer", ID, "sending COORDINATOR to", p.ID)
+		if p.ID != ID && !hasLeft(p.ID) {
 
 			// Send message to p
 			err := send([]int{ID}, Utils.COORDINATOR, p, &reply)
 			if err != nil {
 				// Peer offline
-				Utils.Print(v, "Peer", ID, "can't contact", p.ID)
+				Events.Debug(Events.New(Events.LOG), "Peer", ID, "can't contact", p.ID)
 				continue
 			}
 		}
@@ -114,25 +119,18 @@ func (b Bully) sendCoordinator() {
 func (r Ring) sendCoordinator() {
 	var reply Utils.Message // Reply message
 
-	log.Println("Peer", ID, "started the election:", ring)
-
-	if coordinator == ID {
-		log.Println("Peer", ID, "recognized itself as COORDINATOR.")
-	} else {
-		log.Println("Peer", ID, "recognized", coordinator, "as COORDINATOR.")
-	}
+	Events.Info(Events.New(Events.LOG), "Peer", ID, "started the election:", ring)
 
 	// Send COORDINATOR to peers
 	for i := 0; i <= len(peerList)-1; i++ {
 		p := peerList[i]
-		if p.ID != ID {
-			Utils.Print(v, "Peer", ID, "sending COORDINATOR to", p.ID)
+		if p.ID != ID && !hasLeft(p.ID) {
 
 			// Send message to p
 			err := send([]int{coordinator}, Utils.COORDINATOR, p, &reply)
 			if err != nil {
 				// Peer offline
-				Utils.Print(v, "Peer", ID, "can't contact", p.ID)
+				Events.Debug(Events.New(Events.LOG), "Peer", ID, "can't contact", p.ID)
 				continue
 			}
 		}
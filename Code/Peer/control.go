@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"prog/Events"
+	"prog/Utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type ControlApi int // Used to publish the control RPC methods
+
+var pauseMu sync.Mutex    // Protect pausedUntil
+var pausedUntil time.Time // The peer is paused until this time
+
+var blockMu sync.Mutex           // Protect blockedTo and blockedFrom
+var blockedTo = map[int]bool{}   // Messages to these peers are dropped
+var blockedFrom = map[int]bool{} // Messages from these peers are dropped
+
+var errPaused = errors.New("peer is paused")
+var errPartitioned = errors.New("peer is in another partition")
+var errDropped = errors.New("message dropped")
+
+// Status Exported method that returns the state of the peer
+func (t *ControlApi) Status(args *int, reply *Utils.Status) error {
+	reply.ID = ID
+	reply.Coordinator = coordinator
+	reply.Term = term
+	reply.Elections = int(electionsStarted.Value())
+	reply.Election = (alg == Utils.BULLY && election) || (alg == Utils.RING && ring != nil)
+	reply.Paused = paused()
+	reply.Members, reply.Down = memberView()
+	reply.Sent, reply.Received, reply.Failed = map[string]int{}, map[string]int{}, map[string]int{}
+	for msg := Utils.ELECTION; msg <= Utils.TIMEOUT_NOW; msg++ {
+		name := Utils.MessageName(msg)
+		reply.Sent[name] = int(msgSent.Value(name))
+		reply.Received[name] = int(msgReceived.Value(name))
+		reply.Failed[name] = int(msgFailed.Value(name))
+	}
+	return nil
+}
+
+// Crash Exported method that makes the peer crash after sending the reply
+func (t *ControlApi) Crash(args *int, reply *bool) error {
+	Events.Info(Events.New(Events.LOG), "Peer", ID, "received a crash command.")
+	*reply = true
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		crashPeer()
+	}()
+	return nil
+}
+
+// Pause Exported method that makes the peer unresponsive for the given duration
+func (t *ControlApi) Pause(args *time.Duration, reply *bool) error {
+	pauseMu.Lock()
+	pausedUntil = time.Now().Add(*args)
+	pauseMu.Unlock()
+	Events.Info(Events.New(Events.PAUSE), "Peer", ID, "paused for", *args)
+	*reply = true
+	return nil
+}
+
+// Block Exported method that adds one-way partition rules
+func (t *ControlApi) Block(args *Utils.Block, reply *bool) error {
+	blockMu.Lock()
+	for _, p := range args.To {
+		blockedTo[p] = true
+	}
+	for _, p := range args.From {
+		blockedFrom[p] = true
+	}
+	blockMu.Unlock()
+	Events.Info(Events.New(Events.PARTITION), "Peer", ID, "drops messages to", args.To, "and from", args.From)
+	*reply = true
+	return nil
+}
+
+// Heal Exported method that removes all partition rules
+func (t *ControlApi) Heal(args *int, reply *bool) error {
+	blockMu.Lock()
+	blockedTo = map[int]bool{}
+	blockedFrom = map[int]bool{}
+	blockMu.Unlock()
+	Events.Info(Events.New(Events.HEAL), "Peer", ID, "partition healed.")
+	*reply = true
+	return nil
+}
+
+// Reload Exported method that applies a new configuration without restarting the peer. args are variables
+// named as in the environment, e.g. HEARTBEAT, if there are none the changes of the config file are applied.
+// The reply describes the changes
+func (t *ControlApi) Reload(args map[string]string, reply *[]string) error {
+	diff, err := reload(args)
+	*reply = diff
+	return err
+}
+
+// SetDelay Exported method that sets the main parameter in ms of the default delay model. It's applied as a
+// reload of DELAY, so the configuration keeps it and the next reloads do not revert it
+func (t *ControlApi) SetDelay(args *int, reply *bool) error {
+	c := getConf()
+	vars := map[string]string{"DELAY": strconv.Itoa(*args), "DELAY_MODEL": c.DelayConf().Model}
+
+	// A default model in the network configuration overrides DELAY, it's removed
+	if c.Network.Delay != nil {
+		nc := c.Network
+		nc.Delay = nil
+		j, err := json.Marshal(nc)
+		if err != nil {
+			return err
+		}
+		vars["NETWORK"] = string(j)
+	}
+	_, err := reload(vars)
+	if err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// Leave Exported method that makes the peer leave the network gracefully after sending the reply
+func (t *ControlApi) Leave(args *int, reply *bool) error {
+	Events.Info(Events.New(Events.LOG), "Peer", ID, "received a leave command.")
+	*reply = true
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		leave()
+	}()
+	return nil
+}
+
+// Elect Exported method that makes the peer start an election
+func (t *ControlApi) Elect(args *int, reply *bool) error {
+	Events.Info(Events.New(Events.LOG), "Peer", ID, "received an elect command.")
+	*reply = true
+	go func() {
+		startCh <- ID
+	}()
+	return nil
+}
+
+// Check if the messages to peer id are dropped, or the messages from it if from is true. The maps are read
+// under the lock because Block and Heal change them while the messages are sent and received
+func blocked(id int, from bool) bool {
+	blockMu.Lock()
+	defer blockMu.Unlock()
+	if from {
+		return blockedFrom[id]
+	}
+	return blockedTo[id]
+}
+
+// Check if the peer is paused
+func paused() bool {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return time.Now().Before(pausedUntil)
+}
+
+// Block the caller while the peer is paused
+func waitPause() {
+	for {
+		pauseMu.Lock()
+		d := time.Until(pausedUntil)
+		pauseMu.Unlock()
+		if d <= 0 {
+			return
+		}
+		time.Sleep(d)
+	}
+}
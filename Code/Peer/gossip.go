@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/rpc"
+	"prog/Config"
+	"prog/Utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phayes/freeport"
+)
+
+// With gossip discovery the peers start without the register service. Each peer knows some seeds and
+// periodically exchanges the addresses it knows with a random peer, until all peers know the same list.
+// The IDs are the positions of the addresses in the sorted list, so every peer derives the same IDs.
+// Then the peers answer the Register methods used by the other services, like the register does
+
+type GossipApi int   // Used to publish the gossip RPC methods
+type RegisterApi int // Used to publish the register RPC methods served by the peers with gossip discovery
+
+const gossipPath = "/_gossip_"            // HTTP path of the gossip RPC server, served before the peer joins
+const gossipTime = 200 * time.Millisecond // Interval between two gossip exchanges
+const gossipLog = 10 * time.Second        // Interval between two logs of an incomplete membership
+var gossipServer = rpc.NewServer()        // RPC server of the gossip methods
+var joined = make(chan struct{})          // Closed when the peer has its ID, the other requests wait for it
+var gossipMu sync.Mutex                   // Protect members
+var members = map[string]bool{}           // Known peer addresses, true if the peer knows all the others
+
+// Exchange Exported method that merges the addresses known by another peer and returns the ones known by
+// this peer
+func (t *GossipApi) Exchange(args map[string]bool, reply *map[string]bool) error {
+	*reply = merge(args)
+	return nil
+}
+
+// Rejoin Exported method that a restarted peer calls to take back its ID and address
+func (t *RegisterApi) Rejoin(args *int, reply *Utils.RegistrationReply) error {
+	if *args < 0 || *args >= len(peerList) {
+		return fmt.Errorf("peer %d is not in the network", *args)
+	}
+	reply.ID = *args
+	reply.Peers = peerList
+	return nil
+}
+
+// GetPeers Exported method that returns the peers of the network
+func (t *RegisterApi) GetPeers(args *int, reply *[]Utils.Peer) error {
+	*reply = append([]Utils.Peer(nil), peerList...)
+	return nil
+}
+
+// Serve the RPC requests, only the gossip requests are served before the peer joins the network
+func serve(lis net.Listener) {
+	go func() {
+		err := http.Serve(lis, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != gossipPath {
+				<-joined
+			}
+			http.DefaultServeMux.ServeHTTP(w, r)
+		}))
+		if err != nil && !isLeaving() {
+			log.Fatalln("Serve error:", err)
+		}
+	}()
+}
+
+// Listen on the configured port, or on the port of a free seed of this host, or on a random port
+func listen() (net.Listener, error) {
+	if conf.Peer.Port != "" {
+		port = conf.Peer.Port
+		return net.Listen("tcp", ip+":"+port)
+	}
+	if conf.Discovery == Config.GOSSIP {
+		for _, s := range conf.Seeds {
+			if s.IP != ip {
+				continue
+			}
+			lis, err := net.Listen("tcp", s.String())
+			if err == nil {
+				port = s.Port
+				return lis, nil
+			}
+		}
+	}
+	p, err := freeport.GetFreePort()
+	if err != nil {
+		return nil, err
+	}
+	port = strconv.Itoa(p)
+	return net.Listen("tcp", ip+":"+port)
+}
+
+// Join the network with gossip discovery, the peer serves the gossip requests while the others join
+func join(lis net.Listener) (Utils.RegistrationReply, error) {
+	err := gossipServer.RegisterName("Gossip", new(GossipApi))
+	if err == nil {
+		err = rpc.RegisterName("Register", new(RegisterApi))
+	}
+	if err != nil {
+		return Utils.RegistrationReply{}, err
+	}
+	http.Handle(gossipPath, gossipServer)
+
+	self := ip + ":" + port
+	merge(map[string]bool{self: false})
+	serve(lis)
+	log.Println("Peer", self, "is joining the network from the seeds", conf.SeedAddrs())
+
+	last := time.Now()
+	for {
+		known, done := membership()
+		if done {
+			break
+		}
+		if len(known) > conf.Peers {
+			return Utils.RegistrationReply{}, fmt.Errorf("%d peers joined a network of %d: %v", len(known),
+				conf.Peers, addresses(known))
+		}
+		if time.Since(last) > gossipLog {
+			log.Println("Peer", self, "knows", len(known), "of", conf.Peers, "peers, still joining.")
+			last = time.Now()
+		}
+
+		// Push and pull the addresses with a random peer or seed
+		addr := target(known, self)
+		cli, err := rpc.DialHTTPPath("tcp", addr, gossipPath)
+		if err == nil {
+			var reply map[string]bool
+			err = cli.Call("Gossip.Exchange", known, &reply)
+			cli.Close()
+			if err == nil {
+				merge(reply)
+			}
+		}
+		if err != nil {
+			log.Println("Gossip with", addr, "error:", err)
+		}
+		time.Sleep(gossipTime)
+	}
+
+	// The IDs are the positions in the list sorted by IP address and port
+	known, _ := membership()
+	var reply Utils.RegistrationReply
+	for i, a := range addresses(known) {
+		j := strings.LastIndex(a, ":")
+		reply.Peers = append(reply.Peers, Utils.Peer{ID: i, IP: a[:j], Port: a[j+1:]})
+		if a == self {
+			reply.ID = i
+		}
+	}
+	return reply, nil
+}
+
+// Merge the addresses known by another peer, return a copy of the addresses known by this peer.
+// A peer knows all the others when it knows conf.Peers addresses
+func merge(m map[string]bool) map[string]bool {
+	gossipMu.Lock()
+	defer gossipMu.Unlock()
+	for a, ready := range m {
+		members[a] = members[a] || ready
+	}
+	if len(members) == getConf().Peers {
+		members[ip+":"+port] = true
+	}
+	known := make(map[string]bool, len(members))
+	for a, ready := range members {
+		known[a] = ready
+	}
+	return known
+}
+
+// Return the known addresses and true if all peers know all the others
+func membership() (map[string]bool, bool) {
+	known := merge(nil)
+	if len(known) != getConf().Peers {
+		return known, false
+	}
+	for _, ready := range known {
+		if !ready {
+			return known, false
+		}
+	}
+	return known, true
+}
+
+// Return a random known peer or seed other than self
+func target(known map[string]bool, self string) string {
+	var addrs []string
+	for a := range known {
+		if a != self {
+			addrs = append(addrs, a)
+		}
+	}
+	for _, s := range getConf().SeedAddrs() {
+		if _, ok := known[s]; s != self && !ok {
+			addrs = append(addrs, s)
+		}
+	}
+	if len(addrs) == 0 {
+		return self
+	}
+	return addrs[rand.Intn(len(addrs))]
+}
+
+// Return the addresses sorted by IP address and port
+func addresses(known map[string]bool) []string {
+	addrs := make([]string, 0, len(known))
+	for a := range known {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		a, b := addrs[i], addrs[j]
+		ia, ib := strings.LastIndex(a, ":"), strings.LastIndex(b, ":")
+		if a[:ia] != b[:ib] {
+			return a[:ia] < b[:ib]
+		}
+		pa, _ := strconv.Atoi(a[ia+1:])
+		pb, _ := strconv.Atoi(b[ib+1:])
+		return pa < pb
+	})
+	return addrs
+}
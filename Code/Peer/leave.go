@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"prog/Config"
+	"prog/Events"
+	"prog/Utils"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var leftMu sync.Mutex     // Protect left
+var left = map[int]bool{} // Peers that left the network gracefully
+var leaving int32         // Set to 1 when the peer is leaving, it does not answer anymore
+var leaveOnce sync.Once   // The peer leaves only once
+var listener net.Listener // Listener of the RPC requests, closed when the peer leaves
+var errLeaving = errors.New("peer is leaving the network")
+
+const leaveTimeout = 5 * time.Second // Maximum time to deregister from the register service
+
+// Leave the network gracefully on SIGTERM
+func handleTerm() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM)
+	<-sig
+	leave()
+}
+
+// Leave the network: deregister from the register service, send LEAVE to the other peers, close the
+// listener and the event log, then exit. If the peer is the coordinator, it asks the first peer that
+// received LEAVE to start an election, so the others do not wait for the heartbeats to detect a failure
+func leave() {
+	leaveOnce.Do(func() {
+		atomic.StoreInt32(&leaving, 1)
+		clock.Tick()
+		Events.Info(Events.New(Events.LEAVE), "Peer", ID, "is leaving the network.")
+
+		// With gossip discovery there is no register to deregister from
+		if getConf().Discovery != Config.GOSSIP {
+			done := make(chan error, 1)
+			go func() {
+				var ok bool
+				id := ID
+				done <- callRegister("Register.Deregister", &id, &ok)
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					log.Println("Deregister error:", err)
+				}
+			case <-time.After(leaveTimeout):
+				log.Println("Deregister error: the register service did not answer in", leaveTimeout)
+			}
+		}
+
+		// Notify the other peers, the first one that answers is the successor
+		var successor *Utils.Peer
+		for _, p := range peerList {
+			if p.ID != ID && !hasLeft(p.ID) {
+				err := send([]int{ID}, Utils.LEAVE, p, new(Utils.Message))
+				if err != nil {
+					Events.Debug(Events.New(Events.LOG), "Peer", ID, "can't contact", p.ID)
+					continue
+				}
+				if successor == nil {
+					p := p
+					successor = &p
+				}
+			}
+		}
+
+		// Hand off the leadership
+		if coordinator == ID && successor != nil {
+			Events.Info(Events.New(Events.LOG), "Peer", ID, "asks peer", successor.ID, "to start an election.")
+			err := control(*successor, "Control.Elect")
+			if err != nil {
+				Events.Error(Events.New(Events.LOG), "Peer", ID, "cannot hand off the leadership:", err)
+			}
+		}
+
+		// Stop serving and exit
+		if listener != nil {
+			listener.Close()
+		}
+		err := Events.Close()
+		if err != nil {
+			log.Println("Close event log error:", err)
+		}
+		os.Exit(0)
+	})
+}
+
+// Check if the peer is leaving the network
+func isLeaving() bool {
+	return atomic.LoadInt32(&leaving) == 1
+}
+
+// Check if peer id left the network
+func hasLeft(id int) bool {
+	leftMu.Lock()
+	defer leftMu.Unlock()
+	return left[id]
+}
+
+// Mark peer id as left, or as back in the network when it rejoins
+func setLeft(id int, l bool) {
+	leftMu.Lock()
+	defer leftMu.Unlock()
+	if l {
+		left[id] = true
+	} else {
+		delete(left, id)
+	}
+}
+
+// Call a control method of another peer
+func control(p Utils.Peer, method string) error {
+	cli, err := rpc.DialHTTP("tcp", p.IP+":"+p.Port)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	var ok bool
+	return cli.Call(method, 0, &ok)
+}
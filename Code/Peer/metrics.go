@@ -0,0 +1,62 @@
+package main
+
+import (
+	"prog/Events"
+	"prog/Metrics"
+	"time"
+)
+
+// Metrics exposed by the peer on the /metrics endpoint
+var (
+	msgSent = Metrics.NewCounter("peer_messages_sent_total",
+		"Number of messages sent by the peer.", "type")
+	msgReceived = Metrics.NewCounter("peer_messages_received_total",
+		"Number of messages received by the peer.", "type")
+	msgFailed = Metrics.NewCounter("peer_messages_failed_total",
+		"Number of messages that the peer could not deliver.", "type")
+	electionsStarted = Metrics.NewCounter("peer_elections_started_total",
+		"Number of elections started by the peer.")
+	electionDuration = Metrics.NewHistogram("peer_election_duration_seconds",
+		"Time from the start of an election to the recognition of the coordinator.",
+		[]float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32})
+	rpcLatency = Metrics.NewHistogram("peer_rpc_latency_seconds",
+		"Latency of the SendMessage RPC, including the random delay.", nil, "type")
+	coordinatorGauge = Metrics.NewGauge("peer_coordinator",
+		"ID of the coordinator known by the peer (-1 if unknown).")
+	livePeersGauge = Metrics.NewGauge("peer_live_peers",
+		"Number of peers believed alive by the peer.")
+)
+
+var electionStart time.Time // Start time of the election the peer is waiting to complete
+
+func init() {
+	coordinatorGauge.Set(-1)
+}
+
+// Set the coordinator of the peer and update election metrics
+func setCoordinator(id int) {
+	coordinator = id
+	coordinatorGauge.Set(float64(id))
+	clock.Tick()
+
+	e := Events.New(Events.COORDINATOR)
+	e.To = id
+	if id == ID {
+		Events.Info(e, "Peer", ID, "recognized itself as COORDINATOR.")
+	} else {
+		Events.Info(e, "Peer", ID, "recognized", id, "as COORDINATOR.")
+	}
+
+	// Observe election duration if the peer was waiting an election result
+	if !electionStart.IsZero() {
+		electionDuration.Observe(time.Since(electionStart).Seconds())
+		electionStart = time.Time{}
+	}
+}
+
+// Mark the start of an election the peer takes part in
+func startElectionTimer() {
+	if electionStart.IsZero() {
+		electionStart = time.Now()
+	}
+}
@@ -1,21 +1,21 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/rpc"
 	"os"
+	"prog/Config"
+	"prog/Events"
+	"prog/Metrics"
+	"prog/Network"
 	"prog/Utils"
 	"sort"
-	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/joho/godotenv"
-	"github.com/phayes/freeport"
 )
 
 type PeerApi int // Used to publish RPC method
@@ -23,19 +23,34 @@ type PeerApi int // Used to publish RPC method
 var ID int                // Peer ID
 var peerList []Utils.Peer // List of peers in the network
 var numPeer int           // Number of peers in the network
-var conf Utils.Conf       // Configuration of peer and register service
+var conf Config.Config    // Configuration of peer and register service
 var ip, port string       // IP address and port of the peer
-var v = false             // Verbose flag
-var vv = false            // Full verbose flag (include debug information about delay)
 
-var coordinator int // ID of the coordinator peer
-var delay int       // Maximum delay to send a message in ms
-var hbTime int      // Duration of the shift of the heartbeat service
-var hbPeer int      // ID of the peer that can run the heartbeat service
+var coordinator int          // ID of the coordinator peer
+var term int                 // Election term known by the peer, incremented by each new election
+var clock *Utils.Clock       // Lamport and vector clocks of the peer
+var coordTerm int            // Term of the last COORDINATOR message accepted
+var network *Network.Network // Delay models and loss probabilities of the links
+var hbTime int64             // Duration of the shift of the heartbeat service, changed by reloads
+var hbPeer int               // ID of the peer that can run the heartbeat service
+
+var seq int64                     // Sequence number of the last message sent
+var seenMu sync.Mutex             // Protect seen
+var seen = map[int]map[int]bool{} // Sequence numbers of the messages received from each peer
+
+const maxAttempts = 3 // Attempts to send a message on lossy networks
+const seenSize = 1000 // Messages remembered for each sender to discard duplicates
+
+const registerTimeout = 30 * time.Second // Time to wait for the register service when it's not reachable
 
 var ch chan Utils.Message // Go channel to handle messages
 var hbCh chan int         // Go channel to handle heartbeat messages
 var crCh chan int         // Go channel to handle peer crash during tests
+var elCh chan int         // Go channel to request a new election when peers disagree on the coordinator
+var startCh chan int      // Go channel to start an election on command
+var tnCh chan int         // Go channel to start the election of a leadership transfer
+var trCh chan transferReq // Go channel to hand the leadership to another peer on command
+var mbCh chan Utils.Peer  // Go channel to update the address of a peer known by the membership watch
 
 var election bool // Used only by Bully algorithm. If true, the peer is part of an election
 var ring []int    // Used only by Ring algorithm. Contains the peers that are part of the election
@@ -44,37 +59,25 @@ var crash bool    // Used in test execution. If true the peer will crash
 
 func main() {
 
-	log.Println("Peer service startup, reading config and .env files.")
+	log.Println("Peer service startup, reading the configuration.")
 
 	// Set randomizer seed
 	rand.Seed(time.Now().UnixNano())
 
-	// Load .env file
-	err := godotenv.Load()
+	// Read the configuration from config.json, the environment and the flags
+	var err error
+	conf, err = Config.Parse("peer", os.Args[1:])
 	if err != nil {
-		log.Fatalln("Load env file error:", err)
-	}
-
-	// Setting v flag
-	if os.Getenv("VERBOSE") == "1" {
-		v = true
-	}
-
-	// Setting vv flag
-	if os.Getenv("VERBOSE") == "2" {
-		v = true
-		vv = true
+		log.Fatalln("Configuration error:", err)
 	}
 
-	// Setting delay
-	delay, err = strconv.Atoi(os.Getenv("DELAY"))
-	if err != nil {
-		log.Fatalln("AtoI delay error:", err)
-	}
+	// Setting log level
+	level, _ := Events.ParseLevel(conf.LogLevel)
+	Events.SetLevel(level)
 
 	// Setting algorithm type
 	var a Algorithm
-	switch os.Getenv("ALGO") {
+	switch conf.Algorithm {
 	case "bully":
 		alg = Utils.BULLY
 		a = Bully{}
@@ -84,105 +87,155 @@ func main() {
 	}
 
 	// Setting heartbeat time
-	hbTime, err = strconv.Atoi(os.Getenv("HEARTBEAT"))
-	if err != nil {
-		log.Fatalln("AtoI heartbeat time error:", err)
-	}
+	hbTime = int64(conf.Heartbeat)
 
 	// Make GO channels
 	ch = make(chan Utils.Message)
 	hbCh = make(chan int)
 	crCh = make(chan int)
-
-	// Reading config file to retrieve IP address and port
-	j, err := os.ReadFile("./config.json")
+	elCh = make(chan int)
+	startCh = make(chan int)
+	tnCh = make(chan int)
+	trCh = make(chan transferReq)
+	mbCh = make(chan Utils.Peer)
+
+	// Setting delay models, the default one is in the network configuration or selected by DELAY_MODEL
+	dc := conf.DelayConf()
+	model, err := Network.NewModel(dc)
 	if err != nil {
-		log.Fatalln("Open config file error:", err)
+		log.Fatalln("Delay model error:", err)
 	}
-
-	// Unmarshalling json file
-	err = json.Unmarshal(j, &conf)
+	network, err = Network.New(model, conf.Network)
 	if err != nil {
-		log.Fatalln("Unmarshal configuration file error:", err)
+		log.Fatalln("Network configuration error:", err)
 	}
 
 	// Register RPC method
 	err = rpc.RegisterName("Peer", new(PeerApi))
-	rpc.HandleHTTP()
-
-	// Connect to register service
-	regIP := conf.Register.IP
-	regPort := conf.Register.Port
-	addr := regIP + ":" + regPort
-	cli, err := rpc.DialHTTP("tcp", addr)
 	if err != nil {
-		log.Fatalln("Error dial with register service:", err)
+		log.Fatalln("RegisterName error:", err)
 	}
-
-	// Set random port
-	p, err := freeport.GetFreePort()
+	err = rpc.RegisterName("Control", new(ControlApi))
 	if err != nil {
-		log.Fatalln("GetFreePort error:", err)
+		log.Fatalln("RegisterName error:", err)
 	}
+	rpc.HandleHTTP()
+
+	// Expose metrics
+	http.Handle("/metrics", Metrics.Handler())
 
-	// Open connection
 	ip = conf.Peer.IP
-	port = strconv.Itoa(p)
-	lis, err := net.Listen("tcp", ip+":"+port)
-	if err != nil {
-		log.Fatalln("Listen error:", err)
-	}
+	var reply Utils.RegistrationReply
+	var lis net.Listener
+	rejoin := conf.Rejoin >= 0
+	gossip := conf.Discovery == Config.GOSSIP
+	if rejoin {
+
+		// A restarted peer takes back its ID and address
+		id := conf.Rejoin
+		err = callRegister("Register.Rejoin", &id, &reply)
+		if err != nil {
+			log.Fatalln("Error call Rejoin:", err)
+		}
+		for _, p := range reply.Peers {
+			if p.ID == id {
+				port = p.Port
+			}
+		}
+		lis, err = net.Listen("tcp", ip+":"+port)
+		if err != nil {
+			log.Fatalln("Listen error:", err)
+		}
 
-	// Initialize struct peer
-	peer := Utils.Peer{
-		IP:   ip,
-		Port: port,
-	}
+		// The sequence numbers must be higher than the ones of the previous process
+		seq = time.Now().UnixNano()
 
-	// Call remote method RegisterPeer
-	var reply Utils.RegistrationReply
-	err = cli.Call("Register.RegisterPeer", &peer, &reply)
-	if err != nil {
-		log.Fatalln("Error call RegisterPeer:", err)
+	} else {
+
+		// Open connection on the configured port, on a seed port or on a random port
+		lis, err = listen()
+		if err != nil {
+			log.Fatalln("Listen error:", err)
+		}
+
+		if gossip {
+
+			// Join the network exchanging the peer addresses, without the register service
+			reply, err = join(lis)
+			if err != nil {
+				log.Fatalln("Gossip join error:", err)
+			}
+		} else {
+
+			// Initialize struct peer
+			peer := Utils.Peer{
+				IP:   ip,
+				Port: port,
+			}
+
+			// Call remote method RegisterPeer
+			err = callRegister("Register.RegisterPeer", &peer, &reply)
+			if err != nil {
+				log.Fatalln("Error call RegisterPeer:", err)
+			}
+		}
 	}
 
 	// Setting peer ID and retrieve information about other peers
 	ID = reply.ID
 	peerList = reply.Peers
 	numPeer = len(peerList)
-	Utils.Print(v, "Register service assigned to this peer the id:", ID)
-	err = cli.Close()
+	clock = Utils.NewClock(ID, numPeer)
+	Events.SetClock(clock)
+	livePeersGauge.Set(float64(numPeer))
+
+	// Setting randomizer seed of an experiment, each peer has its own sequence
+	if conf.Seed != 0 {
+		rand.Seed(conf.Seed*1000 + int64(ID))
+	}
+
+	// Open the event log of the peer
+	err = Events.Open(conf.LogDir, ID, rejoin)
 	if err != nil {
-		log.Fatalln("Error close connection with register service:", err)
+		log.Fatalln("Open event log error:", err)
 	}
+	if gossip {
+		Events.Debug(Events.New(Events.START), "Gossip membership assigned to this peer the id:", ID)
+	} else {
+		Events.Debug(Events.New(Events.START), "Register service assigned to this peer the id:", ID)
+	}
+	Events.Debug(Events.New(Events.LOG), "Peer", ID, "exposes metrics on http://"+ip+":"+port+"/metrics")
 
-	// Set crash flag
-	peersCrash := strings.Split(os.Getenv("CRASH"), ";")
-	for _, pp := range peersCrash {
+	// Reload the configuration on SIGHUP
+	initReload()
 
-		// Get peer ID
-		pID, e := strconv.Atoi(pp)
-		if e != nil {
-			log.Fatalln("AtoI crash peer error:", e)
-		}
+	// Leave the network gracefully on SIGTERM
+	go handleTerm()
+
+	// Set crash flag
+	for _, pID := range getConf().Crash {
 
 		// Check if the peer will crash
 		if pID == ID {
 			crash = true
-			Utils.Print(v, "Peer", ID, "will crash later.")
+			Events.Debug(Events.New(Events.LOG), "Peer", ID, "will crash later.")
 		}
 	}
 
-	// Goroutine for serve RPC request coming from other peers
-	go func() {
-		err = http.Serve(lis, nil)
-		if err != nil {
-			log.Fatalln("Serve error:", err)
-		}
-	}()
+	// Serve RPC request coming from other peers, a peer that joined with gossip is already serving
+	listener = lis
+	close(joined)
+	if !gossip || rejoin {
+		serve(lis)
+	}
 
-	// Initially the peer with lower id starts the election
-	if ID == peerList[0].ID {
+	// Initially the peer with lower id starts the election. A restarted peer catches up with the term of
+	// the others and starts an election to take part in the network again
+	if rejoin {
+		Events.Info(Events.New(Events.RESTART), "Peer", ID, "restarted and rejoined the network.")
+		catchUp()
+		newElection(a)
+	} else if ID == peerList[0].ID {
 		newElection(a)
 	}
 
@@ -191,6 +244,11 @@ func main() {
 	hbPeer = 0
 	go heartbeat()
 
+	// Goroutine that follows the membership of the register, there is no register with gossip discovery
+	if !gossip {
+		go watch()
+	}
+
 	// Infinite loop executed by peer.
 	for {
 
@@ -210,15 +268,19 @@ func main() {
 				if searchElement(msg.ID, ID) {
 					// Check if the peer has started the election
 					if msg.ID[0] == ID {
-						// Send COORDINATOR message
-						sort.Ints(msg.ID)
-						coordinator = msg.ID[len(msg.ID)-1]
+						// Send COORDINATOR message, the target of a leadership transfer is the coordinator
+						if msg.Transfer {
+							setCoordinator(ID)
+						} else {
+							sort.Ints(msg.ID)
+							setCoordinator(msg.ID[len(msg.ID)-1])
+						}
 
 						a.sendCoordinator()
 
 						// Check crash flag for Ring algorithm
 						if crash {
-							os.Exit(0)
+							crashPeer()
 						}
 
 					} else {
@@ -230,8 +292,10 @@ func main() {
 					ring = nil
 
 				} else {
-					// Send election to the next peer
+					// Send election to the next peer, as part of the same leadership transfer if it is
+					setTransfer(msg.Transfer)
 					a.sendElection()
+					setTransfer(false)
 				}
 			}
 
@@ -239,16 +303,43 @@ func main() {
 		case id := <-hbCh:
 
 			// Peer with id is down
-			Utils.Print(v, "Peer", ID, "know that peer", id, "is down.")
+			clock.Tick()
+			Events.Debug(Events.Message(Events.FAILURE, "", id, ID), "Peer", ID, "know that peer", id, "is down.")
 
 			// If the coordinator crashed start a new election
 			if id == coordinator && !election {
 				newElection(a)
 			}
 
+		// Peer with id knows a different coordinator, e.g. after a network partition heals
+		case id := <-elCh:
+			if !election && ring == nil {
+				Events.Info(Events.New(Events.LOG), "Peer", ID, "knows a different coordinator than peer", id,
+					"so it's starting a new election.")
+				newElection(a)
+			}
+
+		// The coordinator handed the leadership to this peer
+		case id := <-tnCh:
+			transferElection(a, id)
+
+		// The coordinator received a transfer command
+		case req := <-trCh:
+			req.done <- handOff(req.target)
+
+		// The membership watch knows a new address of a peer
+		case p := <-mbCh:
+			updatePeer(p)
+
 		// Peer has to crash in this test
 		case <-crCh:
-			os.Exit(0)
+			crashPeer()
+
+		// Peer received an elect command, the bully coordinator keeps the election flag so it's not checked
+		case <-startCh:
+			if alg == Utils.BULLY || ring == nil {
+				newElection(a)
+			}
 		}
 	}
 }
@@ -256,9 +347,43 @@ func main() {
 // SendMessage RPC method provided by peers
 func (t *PeerApi) SendMessage(args *Utils.Message, reply *Utils.Message) error {
 
+	// A paused or leaving peer does not answer, messages from a peer in another partition are dropped
+	if paused() {
+		return errPaused
+	}
+	if isLeaving() {
+		return errLeaving
+	}
+	if blocked(args.From, true) {
+		return errPartitioned
+	}
+
 	// Flag used to check if the peer needs to send a reply
 	replyFlag := false
 
+	// Count received message, update the election term and the logical clocks
+	msgReceived.Inc(Utils.MessageName(args.Msg))
+	updateTerm(args.Term)
+	clock.Receive(args.Lamport, args.Vector)
+
+	// Duplicated ELECTION and COORDINATOR messages are not handled again, Bully ELECTION is answered again
+	if args.Msg != Utils.HEARTBEAT && args.Seq != 0 && duplicate(args.From, args.Seq) {
+		Events.Debug(Events.Message(Events.DUPLICATE, Utils.MessageName(args.Msg), args.From, ID),
+			"Peer", ID, "discarded a duplicated", Utils.MessageName(args.Msg), "from", args.From)
+		if args.Msg == Utils.ELECTION && alg == Utils.BULLY && !args.Transfer {
+			reply.Msg = Utils.OK
+			reply.ID = []int{ID}
+			reply.From = ID
+			reply.Term = term
+		}
+		return nil
+	}
+
+	// A peer that left the network sends messages again when it rejoins
+	if args.Msg != Utils.LEAVE && hasLeft(args.From) {
+		setLeft(args.From, false)
+	}
+
 	// Check type of message received
 	switch args.Msg {
 
@@ -267,14 +392,27 @@ func (t *PeerApi) SendMessage(args *Utils.Message, reply *Utils.Message) error {
 
 		// Check algorithm type
 		if alg == Utils.BULLY {
-			Utils.Print(v, "Peer", ID, "received ELECTION from", args.ID[0])
+			Events.Debug(Events.Message(Events.RECEIVE, "ELECTION", args.From, ID),
+				"Peer", ID, "received ELECTION from", args.ID[0])
+
+			// The ELECTION of a leadership transfer is not answered, the peer defers to the target
+			if args.Transfer {
+				Events.Debug(Events.New(Events.LOG), "Peer", ID, "defers to peer", args.From,
+					"that received the leadership.")
+				break
+			}
 			replyFlag = true     // Peer needs to send OK message
 			reply.Msg = Utils.OK // Send OK message as reply
-			ch <- *args          // Send message to channel
+			reply.ID = []int{ID}
+			reply.From = ID
+			reply.Term = term
+			ch <- *args // Send message to channel
 		} else if alg == Utils.RING {
-			Utils.Print(v, "Peer", ID, "received ELECTION from", args.ID[len(args.ID)-1])
+			Events.Debug(Events.Message(Events.RECEIVE, "ELECTION", args.From, ID),
+				"Peer", ID, "received ELECTION from", args.ID[len(args.ID)-1])
 			if !searchElement(ring, ID) {
-				Utils.Print(v, "Peer", ID, "joined the election:", append(args.ID, ID))
+				Events.Debug(Events.New(Events.JOIN), "Peer", ID, "joined the election:", append(args.ID, ID))
+				startElectionTimer()
 			}
 			ring = args.ID // Copy the election pool to the peer
 			ch <- *args    // Send message to channel
@@ -282,12 +420,14 @@ func (t *PeerApi) SendMessage(args *Utils.Message, reply *Utils.Message) error {
 
 	// COORDINATOR message
 	case Utils.COORDINATOR:
+		Events.Debug(Events.Message(Events.RECEIVE, "COORDINATOR", args.From, ID))
 
-		if args.ID[0] == ID {
-			log.Println("Peer", ID, "recognized itself as COORDINATOR.")
-		} else {
-			log.Println("Peer", ID, "recognized", args.ID[0], "as COORDINATOR.")
+		// A COORDINATOR message of an older election delivered late is ignored
+		if args.Term < coordTerm {
+			Events.Debug(Events.New(Events.LOG), "Peer", ID, "ignored COORDINATOR", args.ID[0], "of term", args.Term)
+			break
 		}
+		coordTerm = args.Term
 
 		// Reset ring if using ring algorithm
 		if alg == Utils.RING {
@@ -295,79 +435,225 @@ func (t *PeerApi) SendMessage(args *Utils.Message, reply *Utils.Message) error {
 		}
 
 		// Set coordinator ID
-		coordinator = args.ID[0]
+		setCoordinator(args.ID[0])
 
 		// Check crash flag non coordinator peer
 		if crash {
 			crCh <- 0
 		}
 
+	// TIMEOUT_NOW message, the coordinator hands the leadership to this peer
+	case Utils.TIMEOUT_NOW:
+		Events.Info(Events.Message(Events.RECEIVE, "TIMEOUT_NOW", args.From, ID),
+			"Peer", ID, "received TIMEOUT_NOW from", args.From)
+		replyFlag = true     // Peer needs to acknowledge the transfer
+		reply.Msg = Utils.OK // Send OK message as reply
+		reply.ID = []int{ID}
+		reply.From = ID
+		reply.Term = term
+		from := args.From
+		go func() {
+			tnCh <- from
+		}()
+
+	// LEAVE message, the sender is not contacted anymore
+	case Utils.LEAVE:
+		Events.Info(Events.Message(Events.RECEIVE, "LEAVE", args.From, ID),
+			"Peer", ID, "knows that peer", args.From, "left the network.")
+		setLeft(args.From, true)
+
 	// HEARTBEAT message
 	case Utils.HEARTBEAT:
-		Utils.Print(vv, "Peer", ID, "received HEARTBEAT from", args.ID[0])
+		Events.Trace(Events.Message(Events.RECEIVE, "HEARTBEAT", args.From, ID),
+			"Peer", ID, "received HEARTBEAT from", args.ID[0])
 
 		// Set reply msg parameters
 		reply.ID = []int{ID}
+		reply.From = ID
+		reply.Term = term
+		reply.Coordinator = coordinator
 		replyFlag = true // Peer needs to send HEARTBEAT message back
 		reply.Msg = Utils.HEARTBEAT
 	}
 
 	// Random delay in ms generated only if the peer needs to send a reply
 	if replyFlag {
-		randomDelay()
+		d := linkDelay(args.From)
+		reply.Lamport, reply.Vector = clock.Tick()
+		if reply.Msg == Utils.OK {
+			e := Events.Message(Events.SEND, "OK", ID, args.From)
+			e.Delay = d
+			e.Lamport, e.Vector = reply.Lamport, reply.Vector
+			Events.Debug(e)
+			msgSent.Inc("OK")
+		}
 	}
 
 	// No error to manage
 	return nil
 }
 
+// Call a method of the register service. If the register is not reachable, e.g. it's restarting, the call
+// is repeated on the next replica, until registerTimeout. The register keeps the same ID for a peer that
+// registers again. With gossip discovery the seeds answer in place of the register
+func callRegister(method string, args any, reply any) error {
+	c := getConf()
+	addrs := c.RegisterAddrs()
+	if c.Discovery == Config.GOSSIP {
+		addrs = c.SeedAddrs()
+	}
+	deadline := time.Now().Add(registerTimeout)
+	for i := 0; ; i++ {
+		cli, err := rpc.DialHTTP("tcp", addrs[i%len(addrs)])
+		if err == nil {
+			err = cli.Call(method, args, reply)
+			cli.Close()
+		}
+		if e, ok := err.(rpc.ServerError); (ok && string(e) != Utils.NoLeader) || err == nil ||
+			time.Now().After(deadline) {
+			return err
+		}
+		log.Println("Register service", addrs[i%len(addrs)], "not available, retrying:", err)
+		if i%len(addrs) == len(addrs)-1 {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// Report to the register service that a peer is down or answers again, the register publishes the change
+// to the watchers of the membership. With gossip discovery there is no register to report to
+func report(typ string, p Utils.Peer) {
+	if getConf().Discovery == Config.GOSSIP {
+		return
+	}
+	var ok bool
+	err := callRegister("Register.Report", &Utils.MemberEvent{Type: typ, Peer: p}, &ok)
+	if err != nil {
+		Events.Debug(Events.New(Events.LOG), "Peer", ID, "could not report", typ, "of peer", p.ID, "to the register:", err)
+	}
+}
+
+// Adopt the highest term known by the live peers, so the messages of a restarted peer are not stale
+func catchUp() {
+	for _, p := range peerList {
+		if p.ID == ID {
+			continue
+		}
+		cli, err := rpc.DialHTTP("tcp", p.IP+":"+p.Port)
+		if err != nil {
+			continue
+		}
+		var st Utils.Status
+		if cli.Call("Control.Status", 0, &st) == nil {
+			updateTerm(st.Term)
+		}
+		cli.Close()
+	}
+}
+
 // Start a new election in Bully algorithm
 func newElection(algorithm Algorithm) {
-	log.Println("Peer", ID, "is starting a new election.")
+	updateTerm(term + 1)
+	clock.Tick()
+	Events.Info(Events.New(Events.ELECTION), "Peer", ID, "is starting a new election.")
+	runElection(algorithm)
+}
+
+// Send the ELECTION messages and, with Bully, the COORDINATOR ones if no higher peer answered
+func runElection(algorithm Algorithm) {
+	electionsStarted.Inc()
+	startElectionTimer()
 	algorithm.sendElection()
 	if (alg == Utils.BULLY) && election {
 		algorithm.sendCoordinator()
 
 		// Check crash flag bully coordinator
 		if crash {
-			os.Exit(0)
+			crashPeer()
 		}
 	}
 }
 
+// Update the election term if t is newer than the known one
+func updateTerm(t int) {
+	if t > term {
+		term = t
+		Events.SetTerm(t)
+	}
+}
+
+// Terminate the peer simulating a crash
+func crashPeer() {
+	clock.Tick()
+	Events.Info(Events.New(Events.CRASH), "Peer", ID, "crashed.")
+	err := Events.Close()
+	if err != nil {
+		log.Println("Close event log error:", err)
+	}
+	os.Exit(0)
+}
+
 // Check peers status by sending heartbeat message
 func heartbeat() {
+	mismatch := make(map[int]int) // Peers that knew a different coordinator in the last shift
+	missed := make(map[int]int)   // Consecutive heartbeats without reply of each peer
 
 	// Execute an infinite loop
 	for {
 		// Repeat every hbTime*numPeers seconds
-		time.Sleep(time.Second * time.Duration(hbTime))
+		time.Sleep(time.Second * time.Duration(atomic.LoadInt64(&hbTime)))
+		waitPause()
 
-		// Check if the peer has to run heartbeat service
-		if hbPeer == ID {
-			log.Println("Peer", ID, "started heartbeat service.")
+		// Check if the peer has to run heartbeat service, a leaving peer does not
+		if hbPeer == ID && !isLeaving() {
+			Events.Info(Events.New(Events.HEARTBEAT), "Peer", ID, "started heartbeat service.")
+			alive := 1                // The peer itself is alive
+			next := make(map[int]int) // Peers that know a different coordinator in this shift
 
 			// Send heartbeat message to all peers
 			for i := 0; i <= len(peerList)-1; i++ {
 				p := peerList[i]
 				beatReply := new(Utils.Message)
-				if p.ID != ID {
-					Utils.Print(vv, "Peer", ID, "sending HEARTBEAT to", p.ID)
+				if p.ID != ID && !hasLeft(p.ID) {
 
 					// Send heartbeat to p
 					err := send([]int{ID}, Utils.HEARTBEAT, p, beatReply)
 					if err != nil {
-						// If p crashed send ERROR to heartbeat channel
-						Utils.Print(vv, "Peer", ID, "not received HEARTBEAT reply from", p.ID)
-						hbCh <- p.ID
+						// If p crashed send ERROR to heartbeat channel, after failures heartbeats without reply
+						Events.Trace(Events.New(Events.LOG), "Peer", ID, "not received HEARTBEAT reply from", p.ID)
+						missed[p.ID]++
+						if missed[p.ID] >= int(atomic.LoadInt64(&failures)) {
+							if missed[p.ID] == int(atomic.LoadInt64(&failures)) {
+								go report(Utils.FAILED, p)
+							}
+							hbCh <- p.ID
+						}
 					}
 
 					// If the peer responds than it is alive
 					if beatReply.Msg == Utils.HEARTBEAT {
-						Utils.Print(v, "Peer", ID, "says", beatReply.ID[0], "is alive.")
+						if missed[p.ID] >= int(atomic.LoadInt64(&failures)) {
+							go report(Utils.RECOVERED, p)
+						}
+						missed[p.ID] = 0
+						Events.Debug(Events.Message(Events.ALIVE, "HEARTBEAT", p.ID, ID),
+							"Peer", ID, "says", beatReply.ID[0], "is alive.")
+						alive++
+
+						// Peers that know a different coordinator in two consecutive shifts need a new election
+						if beatReply.Coordinator != coordinator {
+							if c, ok := mismatch[p.ID]; ok && c == beatReply.Coordinator {
+								elCh <- p.ID
+							}
+							next[p.ID] = beatReply.Coordinator
+						}
 					}
 				}
 			}
+
+			// Update the number of live peers
+			livePeersGauge.Set(float64(alive))
+			mismatch = next
 		}
 
 		// The next peer will run heartbeat service
@@ -375,41 +661,157 @@ func heartbeat() {
 	}
 }
 
-// Send a message to a specific peer
+// Send a message to a specific peer. On lossy networks the message is sent again up to maxAttempts
+// times, the receiver discards the duplicates by message ID
 func send(id []int, msg int, peer Utils.Peer, reply *Utils.Message) error {
 
 	// Make a new message to send
 	message := Utils.Message{
-		ID:  id,
-		Msg: msg,
+		ID:   id,
+		Msg:  msg,
+		From: ID,
+		Term: term,
+		Seq:  int(atomic.AddInt64(&seq, 1)),
+
+		Transfer: msg == Utils.ELECTION && atomic.LoadInt32(&transfer) == 1,
+	}
+
+	// Count sent message and measure latency
+	name := Utils.MessageName(msg)
+	msgSent.Inc(name)
+	start := time.Now()
+	defer func() {
+		rpcLatency.Observe(time.Since(start).Seconds(), name)
+	}()
+
+	// A paused peer sends messages only when it resumes
+	waitPause()
+
+	// COORDINATOR messages can be delivered later than the following messages
+	if msg == Utils.COORDINATOR && network.Reorder() {
+		Events.Debug(Events.Message(Events.REORDER, name, ID, peer.ID), "Peer", ID, "delays", name, "to", peer.ID)
+		go func() {
+			time.Sleep(network.Delay(ID, peer.ID))
+			_ = deliver(message, peer, new(Utils.Message))
+		}()
+		return nil
 	}
 
-	// Wait a random delay
-	randomDelay()
+	attempts := 1
+	if network.Lossy() {
+		attempts = maxAttempts
+	}
+
+	// The zero fields are not decoded, the reply is cleared so that it's not the one of a previous call
+	*reply = Utils.Message{}
+	var err error
+	for i := 0; i < attempts; i++ {
+		err = deliver(message, peer, reply)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		msgFailed.Inc(name)
+		return err
+	}
+
+	// The OK replies are received as the return values of the calls
+	if reply.Msg == Utils.OK {
+		msgReceived.Inc("OK")
+	}
+
+	// The network can duplicate the message
+	if network.Duplicate() {
+		Events.Debug(Events.Message(Events.DUPLICATE, name, ID, peer.ID), "Peer", ID, "duplicates", name, "to", peer.ID)
+		go func() {
+			_ = deliver(message, peer, new(Utils.Message))
+		}()
+	}
+
+	// Return nil if there's no error
+	return nil
+}
+
+// Deliver a message to a peer with a single attempt
+func deliver(message Utils.Message, peer Utils.Peer, reply *Utils.Message) error {
+	name := Utils.MessageName(message.Msg)
+
+	// Heartbeat messages are logged only with full verbosity
+	lvl := Events.DEBUG
+	if message.Msg == Utils.HEARTBEAT {
+		lvl = Events.TRACE
+	}
+
+	// Wait a random delay, then timestamp the message
+	e := Events.Message(Events.SEND, name, ID, peer.ID)
+	e.Delay = linkDelay(peer.ID)
+	message.Lamport, message.Vector = clock.Tick()
+	e.Lamport, e.Vector = message.Lamport, message.Vector
+	Events.Log(lvl, e, "Peer", ID, "sending", name, "to", peer.ID)
+
+	// Messages to a peer in another partition or lost on the link are dropped
+	if blocked(peer.ID, false) || network.Lost(ID, peer.ID) {
+		Events.Log(lvl, Events.Message(Events.SEND_FAIL, name, ID, peer.ID))
+		return errDropped
+	}
 
 	// Connect to the receiver peer
 	cli, err := rpc.DialHTTP("tcp", peer.IP+":"+peer.Port)
 	if err != nil {
+		Events.Log(lvl, Events.Message(Events.SEND_FAIL, name, ID, peer.ID))
 		return err
 	}
+	defer cli.Close()
 
 	// Call the RPC method SendMessage exposed by the receiver peer
-	err = cli.Call("Peer.SendMessage", &message, &reply)
+	err = cli.Call("Peer.SendMessage", &message, reply)
 	if err != nil {
+		Events.Log(lvl, Events.Message(Events.SEND_FAIL, name, ID, peer.ID))
 		return err
 	}
-
-	// Return nil if there's no error
+	updateTerm(reply.Term)
+	if reply.Vector != nil {
+		clock.Receive(reply.Lamport, reply.Vector)
+	}
 	return nil
 }
 
-// Generate random delay in ms
-func randomDelay() {
-	if delay != 0 {
-		d := rand.Intn(delay)
-		Utils.Print(vv, "Peer", ID, "generated this delay in ms:", d)
-		time.Sleep(time.Duration(d) * time.Millisecond)
+// Check if a message has already been received and record it. Only the last messages of each sender
+// are remembered
+func duplicate(from, seq int) bool {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	m, ok := seen[from]
+	if !ok {
+		m = make(map[int]bool)
+		seen[from] = m
+	}
+	if m[seq] {
+		return true
+	}
+	m[seq] = true
+
+	// Forget old messages
+	if len(m) > 2*seenSize {
+		for s := range m {
+			if s < seq-seenSize {
+				delete(m, s)
+			}
+		}
+	}
+	return false
+}
+
+// Generate a random delay for a message to peer to and return it in ms
+func linkDelay(to int) int {
+	d := network.Delay(ID, to)
+	if d == 0 {
+		return 0
 	}
+	Events.Trace(Events.New(Events.DELAY), "Peer", ID, "generated this delay in ms:", d.Milliseconds())
+	time.Sleep(d)
+	return int(d.Milliseconds())
 }
 
 // Search an int from a slice of int
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"prog/Config"
+	"prog/Events"
+	"prog/Network"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+var reloadMu sync.Mutex    // Serialize the reloads, protect conf and fileConf
+var fileConf Config.Config // Configuration read from the file only, to detect the changes of the file
+var failures int64 = 1     // Heartbeats without reply before a peer is down
+
+// Reload the configuration on SIGHUP, the changes of the config file are applied
+func handleHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		_, err := reload(nil)
+		if err != nil {
+			Events.Error(Events.New(Events.LOG), "Peer", ID, "cannot reload the configuration:", err)
+		}
+	}
+}
+
+// Apply the variables to the configuration, the ones that changed in the config file if there are none.
+// Only the variables that can change at run time are applied, return the description of the changes
+func reload(vars map[string]string) ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	fc := fileConf
+	if len(vars) == 0 {
+		fc = Config.Default()
+		err := fc.ReadFile(conf.File)
+		if err != nil {
+			return nil, err
+		}
+		vars = Config.Vars(fileConf, fc)
+	}
+	next, diff, err := conf.Reload(vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(diff) == 0 {
+		fileConf = fc
+		Events.Info(Events.New(Events.RELOAD), "Peer", ID, "reloaded the configuration, nothing changed.")
+		return diff, nil
+	}
+
+	// Build the new values first, so that a rejected configuration changes nothing
+	level, err := Events.ParseLevel(next.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	model, err := Network.NewModel(next.DelayConf())
+	if err != nil {
+		return nil, err
+	}
+	nw, err := Network.New(model, next.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply them together
+	Events.SetLevel(level)
+	atomic.StoreInt64(&hbTime, int64(next.Heartbeat))
+	atomic.StoreInt64(&failures, int64(next.Failures))
+	network.Reconfigure(nw)
+	conf = next
+	fileConf = fc
+
+	Events.Info(Events.New(Events.RELOAD), "Peer", ID, "reloaded the configuration:", strings.Join(diff, ", "))
+	return diff, nil
+}
+
+// Return the configuration, the reloads replace it while the other goroutines read it
+func getConf() Config.Config {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return conf
+}
+
+// Keep the configuration file read at startup, the reloads apply its changes
+func initReload() {
+	fileConf = Config.Default()
+	err := fileConf.ReadFile(conf.File)
+	if err != nil {
+		log.Fatalln("Read config file error:", err)
+	}
+	atomic.StoreInt64(&failures, int64(conf.Failures))
+	go handleHangup()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"prog/Events"
+	"prog/Utils"
+	"sync/atomic"
+)
+
+// Leadership transfer, as TimeoutNow in Raft: the coordinator sends TIMEOUT_NOW to the target, that starts
+// an election at once. Its ELECTION messages carry the Transfer flag: with Bully the higher peers defer to
+// the target instead of answering OK, with Ring the target closes the ring as coordinator instead of the
+// highest peer. So the target wins the election and announces itself with COORDINATOR
+
+var transfer int32 // If 1 the ELECTION messages sent are part of a leadership transfer, read by the senders
+
+// Request of a leadership transfer, handled by the main loop
+type transferReq struct {
+	target int
+	done   chan error // Result of the transfer
+}
+
+// Transfer Exported method that makes the coordinator hand the leadership to the target peer
+func (t *ControlApi) Transfer(args *int, reply *bool) error {
+	if isLeaving() {
+		return errLeaving
+	}
+	req := transferReq{target: *args, done: make(chan error, 1)}
+	trCh <- req
+	err := <-req.done
+	*reply = err == nil
+	return err
+}
+
+// Hand the leadership to the target peer, called by the main loop of the coordinator
+func handOff(target int) error {
+	switch {
+	case coordinator != ID:
+		return fmt.Errorf("peer %d is not the coordinator, the coordinator is %d", ID, coordinator)
+	case target == ID:
+		return fmt.Errorf("peer %d is already the coordinator", ID)
+	}
+	list := peerList
+	if target < 0 || target >= len(list) || hasLeft(target) || isDown(target) {
+		return fmt.Errorf("peer %d is not in the network", target)
+	}
+
+	Events.Info(Events.New(Events.LOG), "Peer", ID, "hands the leadership to peer", target)
+	var ack Utils.Message
+	err := send([]int{ID}, Utils.TIMEOUT_NOW, list[target], &ack)
+	if err != nil {
+		return fmt.Errorf("peer %d did not receive TIMEOUT_NOW: %w", target, err)
+	}
+	if ack.Msg != Utils.OK {
+		return fmt.Errorf("peer %d did not accept the leadership", target)
+	}
+
+	// The bully coordinator keeps the election flag, it's cleared so that the peer starts an election when
+	// the new coordinator fails
+	if alg == Utils.BULLY {
+		election = false
+	}
+	return nil
+}
+
+// Start the election of a leadership transfer, called by the main loop of the target
+func transferElection(algorithm Algorithm, from int) {
+	setTransfer(true)
+	defer setTransfer(false)
+	if alg == Utils.RING {
+		ring = nil
+	}
+	updateTerm(term + 1)
+	clock.Tick()
+	Events.Info(Events.New(Events.TRANSFER), "Peer", ID, "is starting the election of a leadership transfer from peer", from)
+	runElection(algorithm)
+}
+
+// Mark the ELECTION messages sent as part of a leadership transfer or not
+func setTransfer(t bool) {
+	var v int32
+	if t {
+		v = 1
+	}
+	atomic.StoreInt32(&transfer, v)
+}
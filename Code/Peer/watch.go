@@ -0,0 +1,138 @@
+package main
+
+import (
+	"prog/Events"
+	"prog/Utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The peers follow the membership of the register with long polls of Register.Watch, so they do not depend
+// only on the list of the registration: the address of a peer that joins or rejoins is updated, the peers
+// that left or are reported down are marked. The IDs are assigned before the peers start, so a peer with a
+// new ID is not added, the clocks have a fixed size
+
+var downMu sync.Mutex     // Protect down and memberVersion
+var down = map[int]bool{} // Peers reported down by the register
+var memberVersion int     // Version of the membership known by the peer
+
+const watchTime = 30 * time.Second // Maximum wait of a Watch call
+
+// Follow the membership of the register until the peer leaves
+func watch() {
+	var m Utils.Membership
+	for v := 0; !isLeaving(); v = m.Version {
+		m = Utils.Membership{}
+		err := callRegister("Register.Watch", &Utils.WatchArgs{Version: v, Timeout: watchTime}, &m)
+		if err != nil {
+			Events.Debug(Events.New(Events.LOG), "Peer", ID, "cannot watch the membership:", err)
+			m.Version = v
+			time.Sleep(time.Second)
+			continue
+		}
+		if m.Version <= v {
+			continue
+		}
+
+		// The first call, or a call after too many changes, replaces the whole view
+		if v == 0 || m.Events == nil {
+			setMembership(m)
+		} else {
+			for _, e := range m.Events {
+				applyChange(e)
+			}
+		}
+		downMu.Lock()
+		memberVersion = m.Version
+		downMu.Unlock()
+		Events.Debug(Events.New(Events.LOG), "Peer", ID, "knows the membership version", m.Version)
+	}
+}
+
+// Replace the view of the membership
+func setMembership(m Utils.Membership) {
+	for _, p := range m.Peers {
+		if p.ID < len(peerList) && p != peerList[p.ID] {
+			mbCh <- p
+		}
+	}
+	gone := make(map[int]bool)
+	for _, id := range m.Left {
+		gone[id] = true
+	}
+	for _, p := range peerList {
+		if p.ID != ID {
+			setLeft(p.ID, gone[p.ID])
+		}
+	}
+	downMu.Lock()
+	down = make(map[int]bool)
+	for _, id := range m.Down {
+		down[id] = true
+	}
+	downMu.Unlock()
+}
+
+// Apply a change of the membership
+func applyChange(e Utils.MemberEvent) {
+	id := e.Peer.ID
+	if id < 0 || id >= len(peerList) || id == ID {
+		return
+	}
+	Events.Debug(Events.New(Events.LOG), "Peer", ID, "knows the change", e.Version, "of the membership:", e.Type,
+		"of peer", id)
+	switch e.Type {
+	case Utils.JOINED, Utils.REJOINED:
+		if e.Peer != peerList[id] {
+			mbCh <- e.Peer
+		}
+		setLeft(id, false)
+		setDown(id, false)
+	case Utils.LEFT:
+		setLeft(id, true)
+	case Utils.FAILED:
+		setDown(id, true)
+	case Utils.RECOVERED:
+		setDown(id, false)
+	}
+}
+
+// Mark peer id as down or up
+func setDown(id int, d bool) {
+	downMu.Lock()
+	defer downMu.Unlock()
+	if d {
+		down[id] = true
+	} else {
+		delete(down, id)
+	}
+}
+
+// Check if peer id is reported down by the register
+func isDown(id int) bool {
+	downMu.Lock()
+	defer downMu.Unlock()
+	return down[id]
+}
+
+// Update the address of a peer, called by the main loop. The list is copied so that the goroutines that
+// are reading it keep a consistent one
+func updatePeer(p Utils.Peer) {
+	list := append([]Utils.Peer(nil), peerList...)
+	list[p.ID] = p
+	peerList = list
+	Events.Info(Events.New(Events.LOG), "Peer", ID, "updated the address of peer", p.ID, "to", p.IP+":"+p.Port)
+}
+
+// Return the version of the membership known by the peer and the peers reported down
+func memberView() (int, []int) {
+	downMu.Lock()
+	defer downMu.Unlock()
+	ids := make([]int, 0, len(down))
+	for id := range down {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return memberVersion, ids
+}
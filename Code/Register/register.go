@@ -2,15 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/rpc"
 	"os"
+	"prog/Config"
+	"prog/Metrics"
 	"prog/Utils"
 	"strconv"
-
-	"github.com/joho/godotenv"
 )
 
 type RegisterApi int // Used to publish RPC method
@@ -18,41 +20,47 @@ type RegisterApi int // Used to publish RPC method
 var numPeer int           // Number of peers in the network
 var currentPeer = 0       // ID of the current peer served
 var peerList []Utils.Peer // List of peers in the network
-var conf Utils.Conf       // Configuration of peer and register service
+var conf Config.Config    // Configuration of peer and register service
 
 var ch chan int // Go channel to wait for all peers to complete registration
 
+// Metrics exposed by the register service on the /metrics endpoint
+var (
+	registrations = Metrics.NewCounter("register_registrations_total",
+		"Number of RegisterPeer requests served.")
+	registeredPeers = Metrics.NewGauge("register_registered_peers",
+		"Number of peers registered in the network.")
+)
+
 func main() {
 
-	log.Println("Register service startup, reading config and env files.")
+	log.Println("Register service startup, reading the configuration.")
 
-	// Load .env file
-	err := godotenv.Load()
+	// Read the configuration from config.json, the environment and the flags
+	var err error
+	conf, err = Config.Parse("register", os.Args[1:])
 	if err != nil {
-		log.Fatalln("Load env file error:", err)
+		log.Fatalln("Configuration error:", err)
 	}
 
+	// Reload the configuration on SIGHUP
+	initReload()
+
 	// Setting number of peers
-	numPeer, err = strconv.Atoi(os.Getenv("PEERS"))
+	numPeer = getConf().Peers
+
+	// Restore the peers registered before a restart
+	restored, err := loadState()
 	if err != nil {
-		log.Fatalln("AtoI peers number error:", err)
+		log.Fatalln("Restore state error:", err)
+	}
+	if restored {
+		log.Println("Register service restored", len(peerList), "peers from", getConf().StateFile())
 	}
 
 	// Make GO channel
 	ch = make(chan int)
 
-	// Reading config file to retrieve IP address and port
-	j, err := os.ReadFile("./config.json")
-	if err != nil {
-		log.Fatalln("Open config file error:", err)
-	}
-
-	// Unmarshalling json file
-	err = json.Unmarshal(j, &conf)
-	if err != nil {
-		log.Fatalln("Unmarshal config file error:", err)
-	}
-
 	// Registering the RPC method
 	err = rpc.RegisterName("Register", new(RegisterApi))
 	if err != nil {
@@ -62,12 +70,19 @@ func main() {
 	// Handle HTTP request
 	rpc.HandleHTTP()
 
+	// Expose metrics and the list of peer metrics endpoints
+	http.Handle("/metrics", Metrics.Handler())
+	http.HandleFunc("/targets", targets)
+
 	// Register service listening to incoming request
-	lis, err := net.Listen("tcp", ":"+conf.Register.Port)
+	lis, err := net.Listen("tcp", ":"+getConf().RegisterAddr().Port)
 	if err != nil {
 		log.Fatalln("Listen error:", err)
 	}
 
+	// Elect the leader among the register replicas
+	initReplicas()
+
 	// Goroutine that wait all peer before the register service sends the reply
 	go func() {
 		for currentPeer < numPeer {
@@ -89,6 +104,11 @@ func main() {
 // RegisterPeer Exported method that peers call to register on the network
 func (t *RegisterApi) RegisterPeer(args *Utils.Peer, reply *Utils.RegistrationReply) error {
 
+	// Only the leader replica assigns the IDs
+	if currentLeader() != getConf().Replica {
+		return forward("Register.RegisterPeer", args, reply)
+	}
+
 	// Retrieve peer port
 	port, err := strconv.Atoi(args.Port)
 	if err != nil {
@@ -102,14 +122,35 @@ func (t *RegisterApi) RegisterPeer(args *Utils.Peer, reply *Utils.RegistrationRe
 		Port: strconv.Itoa(port),
 	}
 
-	// Add registered peer to the list
-	peerList = append(peerList, peer)
+	stateMu.Lock()
+	if id := registered(peer); id >= 0 {
 
-	// Add to the reply the peer ID
-	reply.ID = currentPeer
+		// The peer registered before a restart of the register service, it keeps its ID
+		log.Println("Peer", id, "registered again.")
+		peer.ID = id
+	} else {
+
+		// Add registered peer to the list
+		peer.ID = currentPeer
+		peerList = append(peerList, peer)
+		registrations.Inc()
+		registeredPeers.Set(float64(len(peerList)))
+
+		// Increment currentPeer and save the new state before replying
+		currentPeer++
+		publish(Utils.JOINED, peer)
+		err = saveState()
+		if err != nil {
+			log.Println("Save state error:", err)
+		}
+	}
+	stateMu.Unlock()
+
+	// Send the new state to the other replicas before replying
+	replicate()
 
-	// Increment currentPeer
-	currentPeer++
+	// Add to the reply the peer ID
+	reply.ID = peer.ID
 
 	// Wait all peers before sends reply
 	<-ch
@@ -119,3 +160,102 @@ func (t *RegisterApi) RegisterPeer(args *Utils.Peer, reply *Utils.RegistrationRe
 
 	return nil
 }
+
+// Rejoin Exported method that a restarted peer calls to take back its ID and address
+func (t *RegisterApi) Rejoin(args *int, reply *Utils.RegistrationReply) error {
+
+	// Only the leader replica changes the membership
+	if currentLeader() != getConf().Replica {
+		return forward("Register.Rejoin", args, reply)
+	}
+
+	stateMu.Lock()
+	if currentPeer < numPeer {
+		stateMu.Unlock()
+		return errors.New("the network is not complete yet")
+	}
+	if *args < 0 || *args >= len(peerList) {
+		stateMu.Unlock()
+		return fmt.Errorf("peer %d is not registered", *args)
+	}
+	log.Println("Peer", *args, "rejoined the network.")
+	setDown(*args, false)
+	mark(&left, *args, false)
+	publish(Utils.REJOINED, peerList[*args])
+	err := saveState()
+	if err != nil {
+		log.Println("Save state error:", err)
+	}
+	reply.ID = *args
+	reply.Peers = peerList
+	stateMu.Unlock()
+
+	replicate()
+	return nil
+}
+
+// Deregister Exported method that a peer calls when it leaves the network gracefully, it keeps its ID and
+// can rejoin later
+func (t *RegisterApi) Deregister(args *int, reply *bool) error {
+
+	// Only the leader replica changes the membership
+	if currentLeader() != getConf().Replica {
+		return forward("Register.Deregister", args, reply)
+	}
+
+	stateMu.Lock()
+	if *args < 0 || *args >= len(peerList) {
+		stateMu.Unlock()
+		return fmt.Errorf("peer %d is not registered", *args)
+	}
+	*reply = mark(&left, *args, true)
+	if *reply {
+		log.Println("Peer", *args, "left the network.")
+		setDown(*args, false)
+		publish(Utils.LEFT, peerList[*args])
+		err := saveState()
+		if err != nil {
+			log.Println("Save state error:", err)
+		}
+	}
+	stateMu.Unlock()
+
+	if *reply {
+		replicate()
+	}
+	return nil
+}
+
+// GetPeers Exported method that returns the peers registered so far
+func (t *RegisterApi) GetPeers(args *int, reply *[]Utils.Peer) error {
+	*reply = append([]Utils.Peer(nil), peerList...)
+	return nil
+}
+
+// Serve the peer metrics endpoints in the Prometheus HTTP service discovery format
+func targets(w http.ResponseWriter, r *http.Request) {
+
+	// Targets group of a single peer
+	type group struct {
+		Targets []string          `json:"targets"`
+		Labels  map[string]string `json:"labels"`
+	}
+
+	// Add a group for each registered peer
+	groups := []group{{
+		Targets: []string{getConf().RegisterAddr().String()},
+		Labels:  map[string]string{"job": "register"},
+	}}
+	for _, p := range peerList {
+		groups = append(groups, group{
+			Targets: []string{p.IP + ":" + p.Port},
+			Labels:  map[string]string{"job": "peer", "peer": strconv.Itoa(p.ID)},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(groups)
+	if err != nil {
+		log.Println("Encode targets error:", err)
+	}
+}
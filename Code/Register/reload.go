@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"prog/Config"
+	"prog/Utils"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var reloadMu sync.Mutex    // Serialize the reloads, protect conf and fileConf
+var fileConf Config.Config // Configuration read from the file only, to detect the changes of the file
+
+// Reload the configuration on SIGHUP, the changes of the config file are applied and the peers reload their file
+func handleHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		var reply []string
+		err := new(RegisterApi).Reload(nil, &reply)
+		if err != nil {
+			log.Println("Reload error:", err)
+		}
+	}
+}
+
+// Reload Exported method that applies the variables to the register configuration and forwards them to all
+// peers. Without variables the register and the peers apply the changes of their config file.
+// The reply describes the changes, one line for the register and one for each peer
+func (t *RegisterApi) Reload(args map[string]string, reply *[]string) error {
+	if args == nil {
+		args = make(map[string]string)
+	}
+	reloadMu.Lock()
+	vars := args
+	fc := fileConf
+	if len(vars) == 0 {
+		fc = Config.Default()
+		err := fc.ReadFile(conf.File)
+		if err != nil {
+			reloadMu.Unlock()
+			return err
+		}
+		vars = Config.Vars(fileConf, fc)
+	}
+	next, diff, err := conf.Reload(vars)
+	if err != nil {
+		reloadMu.Unlock()
+		return err
+	}
+	fileConf = fc
+	conf = next
+	reloadMu.Unlock()
+
+	log.Println("Register service reloaded the configuration:", describe(diff))
+	*reply = append(*reply, "register: "+describe(diff))
+
+	// Forward the same request, each peer validates and applies it
+	stateMu.Lock()
+	peers := append([]Utils.Peer(nil), peerList...)
+	stateMu.Unlock()
+	for _, p := range peers {
+		var changes []string
+		err := call(p.IP+":"+p.Port, "Control.Reload", args, &changes)
+		if err != nil {
+			*reply = append(*reply, fmt.Sprintf("peer %d: %v", p.ID, err))
+			continue
+		}
+		*reply = append(*reply, fmt.Sprintf("peer %d: %s", p.ID, describe(changes)))
+	}
+	return nil
+}
+
+// Describe a list of changes
+func describe(diff []string) string {
+	if len(diff) == 0 {
+		return "nothing changed"
+	}
+	return strings.Join(diff, ", ")
+}
+
+// Return the configuration, the reloads replace it while the RPC handlers read it
+func getConf() Config.Config {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return conf
+}
+
+// Keep the configuration file read at startup, the reloads apply its changes
+func initReload() {
+	fileConf = Config.Default()
+	err := fileConf.ReadFile(conf.File)
+	if err != nil {
+		log.Fatalln("Read config file error:", err)
+	}
+	go handleHangup()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/rpc"
+	"prog/Utils"
+	"sync"
+	"time"
+)
+
+// The register can run as several replicas. The leader is elected among them with the Bully algorithm,
+// as the peers do: the live replica with the highest index wins. The leader serves the registrations and
+// sends the new state to the other replicas before replying, the other replicas forward the registrations
+// to the leader and check that it's alive
+
+var replicaMu sync.Mutex // Protect leader and electing
+var leader = -1          // Index of the leader replica, -1 if unknown
+var electing bool        // If true the replica is running an election
+
+const syncTime = time.Second // Interval between two checks of the leader
+
+// Start the replication, a single register is always the leader
+func initReplicas() {
+	c := getConf()
+	if len(c.Replicas) <= 1 {
+		leader = c.Replica
+		return
+	}
+	log.Println("Register replica", c.Replica, "of", len(c.Replicas), "started.")
+	go monitor()
+}
+
+// Return the index of the leader replica, -1 if unknown
+func currentLeader() int {
+	replicaMu.Lock()
+	defer replicaMu.Unlock()
+	return leader
+}
+
+// Check the leader periodically and copy its state, start an election if it does not answer
+func monitor() {
+	self := getConf().Replica
+	for {
+		l := currentLeader()
+		if l < 0 {
+			elect()
+		} else if l != self {
+			var st State
+			err := callReplica(l, "Register.Sync", self, &st)
+			if err != nil {
+				log.Println("Register replica", l, "is down, starting an election.")
+				setLeader(-1)
+				elect()
+			} else {
+				adopt(st)
+			}
+		}
+		time.Sleep(syncTime)
+	}
+}
+
+// Run a Bully election among the replicas
+func elect() {
+	replicaMu.Lock()
+	if electing {
+		replicaMu.Unlock()
+		return
+	}
+	electing = true
+	replicaMu.Unlock()
+	defer func() {
+		replicaMu.Lock()
+		electing = false
+		replicaMu.Unlock()
+	}()
+
+	// A higher replica that answers takes over the election
+	c := getConf()
+	for i := c.Replica + 1; i < len(c.Replicas); i++ {
+		var ok bool
+		if callReplica(i, "Register.Election", c.Replica, &ok) == nil && ok {
+			return
+		}
+	}
+
+	// Before serving, take the most recent state of the live replicas: this replica may have restarted
+	// with an old state. No higher replica answered, so the known leader, if any, is not the leader anymore
+	setLeader(-1)
+	for i := range c.Replicas {
+		var st State
+		if i != c.Replica && callReplica(i, "Register.Sync", c.Replica, &st) == nil {
+			adopt(st)
+		}
+	}
+	setLeader(c.Replica)
+	log.Println("Register replica", c.Replica, "is the leader.")
+
+	// A higher replica that refuses the announcement runs its own election, this replica steps down so
+	// that there are not two leaders assigning IDs
+	for i := range c.Replicas {
+		var ok bool
+		if i != c.Replica && callReplica(i, "Register.Coordinator", c.Replica, &ok) == nil && !ok {
+			log.Println("Register replica", i, "refused the leadership, replica", c.Replica, "steps down.")
+			setLeader(-1)
+			return
+		}
+	}
+}
+
+// Set the index of the leader replica, -1 if unknown
+func setLeader(l int) {
+	replicaMu.Lock()
+	defer replicaMu.Unlock()
+	leader = l
+}
+
+// Election Exported method that a lower replica calls to start an election, the reply is the Bully OK
+func (t *RegisterApi) Election(args int, reply *bool) error {
+	*reply = true
+	go elect()
+	return nil
+}
+
+// Coordinator Exported method that the new leader calls on the other replicas
+func (t *RegisterApi) Coordinator(args int, reply *bool) error {
+
+	// A lower replica cannot be the leader while this one is alive
+	self := getConf().Replica
+	if args < self {
+		go elect()
+		return nil
+	}
+	setLeader(args)
+	log.Println("Register replica", self, "recognized", args, "as leader.")
+	*reply = true
+	return nil
+}
+
+// Sync Exported method that returns the state of the replica
+func (t *RegisterApi) Sync(args int, reply *State) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	*reply = snapshot()
+	reply.Replica = getConf().Replica
+	return nil
+}
+
+// Replicate Exported method that the leader calls to send a new state. The reply is false if the state
+// comes from a replica lower than the leader
+func (t *RegisterApi) Replicate(args *State, reply *bool) error {
+	*reply = adopt(*args)
+	return nil
+}
+
+// Adopt a state if it's more recent than the one of the replica: only the leader changes the membership and
+// each change increments the version, so the state with the higher version contains the other one. The
+// state of a replica lower than the leader is rejected, it's a leader that did not notice the new one yet
+func adopt(st State) bool {
+	if st.Replica < currentLeader() {
+		log.Println("Register replica", getConf().Replica, "rejected the state of replica", st.Replica,
+			"lower than the leader.")
+		return false
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if st.Version <= version {
+		return true
+	}
+	restore(st)
+	err := saveState()
+	if err != nil {
+		log.Println("Save state error:", err)
+	}
+	return true
+}
+
+// Send the state to the other replicas, called by the leader after each change
+func replicate() {
+	c := getConf()
+	if len(c.Replicas) <= 1 {
+		return
+	}
+	var st State
+	new(RegisterApi).Sync(c.Replica, &st)
+	for i := range c.Replicas {
+		var ok bool
+		if i != c.Replica && callReplica(i, "Register.Replicate", &st, &ok) == nil && !ok {
+			log.Println("Register replica", i, "knows a higher leader, replica", c.Replica, "steps down.")
+			setLeader(-1)
+			return
+		}
+	}
+}
+
+// Forward a request that changes the membership to the leader replica. If the leader fails, the peer is
+// asked to call again
+func forward(method string, args any, reply any) error {
+	l := currentLeader()
+	if l < 0 {
+		return errors.New(Utils.NoLeader)
+	}
+	err := callReplica(l, method, args, reply)
+	if _, ok := err.(rpc.ServerError); err != nil && !ok {
+		log.Println("Register replica", l, "error:", err)
+		return errors.New(Utils.NoLeader)
+	}
+	return err
+}
+
+// Call a method of a replica
+func callReplica(i int, method string, args any, reply any) error {
+	return call(getConf().Replicas[i].String(), method, args, reply)
+}
+
+// Call a method of a service
+func call(addr, method string, args any, reply any) error {
+	cli, err := rpc.DialHTTP("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return cli.Call(method, args, reply)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"prog/Utils"
+	"sync"
+)
+
+var stateMu sync.Mutex // Protect peerList and currentPeer while they change and are saved
+
+// State struct, membership saved by the register so that a restarted register assigns the same IDs
+type State struct {
+	Peers   []Utils.Peer        `json:"peers"`            // Registered peers, the ID is the position in the list
+	Next    int                 `json:"next"`             // ID of the next peer that registers
+	Total   int                 `json:"total"`            // Number of peers of the network
+	Version int                 `json:"version"`          // Version of the membership, incremented by each change
+	Down    []int               `json:"down,omitempty"`   // IDs of the peers reported down
+	Left    []int               `json:"left,omitempty"`   // IDs of the peers that left the network
+	Events  []Utils.MemberEvent `json:"events,omitempty"` // Last changes of the membership
+	Replica int                 `json:"-"`                // Replica that sent the state, not saved
+}
+
+// Save the state in the state file. The file is replaced atomically: the state is written in a temporary
+// file of the same directory, synced, then renamed, so a crash leaves either the old or the new state
+func saveState() error {
+	path := getConf().StateFile()
+	j, err := json.MarshalIndent(snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(j)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	// Sync the directory so that the rename survives a crash of the host, not supported on every system
+	d, err := os.Open(dir)
+	if err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Restore the state saved by a previous process of the register, return false if there is none
+func loadState() (bool, error) {
+	path := getConf().StateFile()
+	j, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var st State
+	err = json.Unmarshal(j, &st)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, p := range st.Peers {
+		if p.ID != i {
+			return false, fmt.Errorf("%s: peer %d saved in position %d", path, p.ID, i)
+		}
+	}
+	if st.Next != len(st.Peers) {
+		return false, fmt.Errorf("%s: next ID %d with %d peers", path, st.Next, len(st.Peers))
+	}
+	if st.Version < st.Next {
+		return false, fmt.Errorf("%s: version %d with %d peers", path, st.Version, len(st.Peers))
+	}
+	if st.Total != numPeer {
+		log.Println("Register service state saved for", st.Total, "peers, the network now has", numPeer)
+	}
+	restore(st)
+	return true, nil
+}
+
+// Return the state of the register, called with stateMu held
+func snapshot() State {
+	return State{Peers: append([]Utils.Peer(nil), peerList...), Next: currentPeer, Total: numPeer,
+		Version: version, Down: append([]int(nil), down...), Left: append([]int(nil), left...),
+		Events: append([]Utils.MemberEvent(nil), history...)}
+}
+
+// Replace the state of the register, called with stateMu held
+func restore(st State) {
+	peerList = st.Peers
+	currentPeer = st.Next
+	version = st.Version
+	down = st.Down
+	left = st.Left
+	history = st.Events
+	registeredPeers.Set(float64(len(peerList)))
+	notify()
+}
+
+// Return the ID of a registered peer with the given address, -1 if there is none
+func registered(p Utils.Peer) int {
+	for _, q := range peerList {
+		if q.IP == p.IP && q.Port == p.Port {
+			return q.ID
+		}
+	}
+	return -1
+}
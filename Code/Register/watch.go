@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"prog/Utils"
+	"time"
+)
+
+// The register keeps a version of the membership, incremented by each join, rejoin, failure and recovery
+// of a peer, and the last changes. Register.Watch returns the changes after a version, waiting for the next
+// one, so the peers and the external tools can follow the membership with a long poll
+
+var version int                   // Version of the membership
+var down []int                    // IDs of the peers reported down
+var left []int                    // IDs of the peers that left the network
+var history []Utils.MemberEvent   // Last changes of the membership, the oldest first
+var changed = make(chan struct{}) // Closed and replaced by each change, wakes up the watchers
+
+const maxHistory = 100            // Changes kept by the register
+const maxWatch = 30 * time.Second // Maximum wait of a Watch call
+
+// Watch Exported method that returns the membership when its version is newer than the one of the caller,
+// or when the timeout expires
+func (t *RegisterApi) Watch(args *Utils.WatchArgs, reply *Utils.Membership) error {
+	timeout := args.Timeout
+	if timeout > maxWatch {
+		timeout = maxWatch
+	}
+	stateMu.Lock()
+	wait := changed
+	newer := version > args.Version
+	stateMu.Unlock()
+	if !newer && timeout > 0 {
+		select {
+		case <-wait:
+		case <-time.After(timeout):
+		}
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	reply.Version = version
+	reply.Peers = append([]Utils.Peer(nil), peerList...)
+	reply.Down = append([]int(nil), down...)
+	reply.Left = append([]int(nil), left...)
+	reply.Events = nil
+
+	// The changes are returned only if the register still has all of them
+	if len(history) > 0 && history[0].Version <= args.Version+1 {
+		for _, e := range history {
+			if e.Version > args.Version {
+				reply.Events = append(reply.Events, e)
+			}
+		}
+	}
+	return nil
+}
+
+// Report Exported method that a peer calls when another peer does not answer its heartbeats (FAILED) or
+// answers again (RECOVERED)
+func (t *RegisterApi) Report(args *Utils.MemberEvent, reply *bool) error {
+
+	// Only the leader replica changes the membership
+	if currentLeader() != getConf().Replica {
+		return forward("Register.Report", args, reply)
+	}
+
+	stateMu.Lock()
+	id := args.Peer.ID
+	if id < 0 || id >= len(peerList) {
+		stateMu.Unlock()
+		return fmt.Errorf("peer %d is not registered", id)
+	}
+	switch args.Type {
+	case Utils.FAILED:
+
+		// A peer that left is not down
+		*reply = !contains(left, id) && setDown(id, true)
+	case Utils.RECOVERED:
+		*reply = setDown(id, false)
+	default:
+		stateMu.Unlock()
+		return fmt.Errorf("unknown report %q", args.Type)
+	}
+
+	// Only the first report of a change is published
+	if *reply {
+		log.Println("Peer", id, "reported", args.Type+".")
+		publish(args.Type, peerList[id])
+		err := saveState()
+		if err != nil {
+			log.Println("Save state error:", err)
+		}
+	}
+	stateMu.Unlock()
+
+	if *reply {
+		replicate()
+	}
+	return nil
+}
+
+// Add a change of the membership and wake up the watchers, called with stateMu held
+func publish(typ string, p Utils.Peer) {
+	version++
+	history = append(history, Utils.MemberEvent{Version: version, Type: typ, Peer: p, Time: time.Now()})
+	if len(history) > maxHistory {
+		history = append([]Utils.MemberEvent(nil), history[len(history)-maxHistory:]...)
+	}
+	notify()
+}
+
+// Wake up the watchers, called with stateMu held
+func notify() {
+	close(changed)
+	changed = make(chan struct{})
+}
+
+// Mark a peer as down or up, return false if it was already. Called with stateMu held
+func setDown(id int, d bool) bool {
+	return mark(&down, id, d)
+}
+
+// Add or remove a peer of a set of IDs, return false if it was already in or out of the set
+func mark(set *[]int, id int, in bool) bool {
+	for i, x := range *set {
+		if x == id {
+			if !in {
+				*set = append((*set)[:i:i], (*set)[i+1:]...)
+			}
+			return !in
+		}
+	}
+	if in {
+		*set = append(*set, id)
+	}
+	return in
+}
+
+// Check if a set of IDs contains a peer
+func contains(set []int, id int) bool {
+	for _, x := range set {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
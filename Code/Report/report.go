@@ -0,0 +1,227 @@
+package Report
+
+import (
+	"fmt"
+	"io"
+	"prog/Checker"
+	"prog/Events"
+	"prog/Faults"
+	"prog/Utils"
+	"sort"
+	"strings"
+)
+
+// Types of the messages, in report order
+var types = []string{"ELECTION", "OK", "COORDINATOR", "HEARTBEAT", "LEAVE", "TIMEOUT_NOW"}
+
+// PeerState struct, final state of a peer
+type PeerState struct {
+	ID          int
+	Live        bool // If true the state was returned by the peer, otherwise it's rebuilt from its event log
+	Crashed     bool
+	Left        bool // If true the peer left the network gracefully
+	Coordinator int  // Coordinator known by the peer, -1 if unknown
+	Term        int
+	Elections   int // Number of elections started by the peer
+	Sent        map[string]int
+	Received    map[string]int
+	Failed      map[string]int
+	Unknown     []string // Types of the messages not counted, missing from the log the state is rebuilt from
+}
+
+// Summary struct, final state of the peers of a run
+type Summary struct {
+	Peers     []PeerState
+	Messages  map[string]int  // Messages sent by all peers by type, a lower bound if a peer did not count them
+	Elections int             // Elections started by all peers
+	Check     *Checker.Report // Result of the expectations of the run, nil if there are none
+}
+
+// Status return the status of the peers registered on the register service that answer, by ID
+func Status(register string) map[int]Utils.Status {
+	status := make(map[int]Utils.Status)
+	cli, err := Utils.DialRegister(register)
+	if err != nil {
+		return status
+	}
+	var peers []Utils.Peer
+	err = cli.Call("Register.GetPeers", 0, &peers)
+	cli.Close()
+	if err != nil {
+		return status
+	}
+	for _, p := range peers {
+		st, err := Faults.GetStatus(p)
+		if err == nil {
+			status[p.ID] = st
+		}
+	}
+	return status
+}
+
+// New build the summary of a run of n peers from the status of the live peers and the event logs
+func New(n int, status map[int]Utils.Status, events []Events.Event) Summary {
+	s := Summary{Messages: make(map[string]int)}
+
+	// Peers that appear in the logs
+	for _, e := range events {
+		if e.Peer >= n {
+			n = e.Peer + 1
+		}
+	}
+
+	for id := 0; id < n; id++ {
+		var p PeerState
+		if st, ok := status[id]; ok {
+			p = PeerState{ID: id, Live: true, Coordinator: st.Coordinator, Term: st.Term, Elections: st.Elections,
+				Sent: st.Sent, Received: st.Received, Failed: st.Failed}
+		} else {
+			p = fromLog(id, events)
+		}
+		for _, e := range events {
+			if e.Peer == id && (e.Type == Events.CRASH || e.Type == Events.RESTART || e.Type == Events.LEAVE) {
+				p.Crashed = e.Type == Events.CRASH
+				p.Left = e.Type == Events.LEAVE
+			}
+		}
+		for t, v := range p.Sent {
+			s.Messages[t] += v
+		}
+		s.Elections += p.Elections
+		s.Peers = append(s.Peers, p)
+	}
+	return s
+}
+
+// Rebuild the state of a peer from its events. Messages are logged only at debug level and heartbeats at
+// trace level, so they are unknown if the log has no events of that level
+func fromLog(id int, events []Events.Event) PeerState {
+	p := PeerState{ID: id, Coordinator: -1, Sent: map[string]int{}, Received: map[string]int{}, Failed: map[string]int{}}
+	level := Events.ERROR
+	for _, e := range events {
+		if e.Peer != id {
+			continue
+		}
+		if l, err := Events.ParseLevel(e.Level); err == nil && l > level {
+			level = l
+		}
+		if e.Term > p.Term {
+			p.Term = e.Term
+		}
+		switch e.Type {
+		case Events.COORDINATOR:
+			p.Coordinator = e.To
+		case Events.ELECTION:
+			p.Elections++
+		case Events.SEND:
+			p.Sent[e.Msg]++
+		case Events.RECEIVE:
+			p.Received[e.Msg]++
+		case Events.SEND_FAIL:
+			p.Failed[e.Msg]++
+		}
+	}
+	switch {
+	case level < Events.DEBUG:
+		p.Unknown = types
+	case level < Events.TRACE:
+		p.Unknown = []string{"HEARTBEAT"}
+	}
+	return p
+}
+
+// Write the summary in a human-readable format
+func (s Summary) Write(w io.Writer) {
+	fmt.Fprintln(w, "Run summary")
+	fmt.Fprintf(w, "  %4s  %-8s %11s %5s %9s %6s %8s %6s\n", "PEER", "STATE", "COORDINATOR", "TERM", "ELECTIONS",
+		"SENT", "RECEIVED", "FAILED")
+	for _, p := range s.Peers {
+		state := "live"
+		switch {
+		case p.Crashed:
+			state = "crashed"
+		case p.Left:
+			state = "left"
+		case !p.Live:
+			state = "down"
+		}
+		coord := "-"
+		if p.Coordinator >= 0 {
+			coord = fmt.Sprint(p.Coordinator)
+		}
+		fmt.Fprintf(w, "  %4d  %-8s %11s %5d %9d %6s %8s %6s\n", p.ID, state, coord, p.Term, p.Elections,
+			p.count(p.Sent), p.count(p.Received), p.count(p.Failed))
+	}
+	fmt.Fprintln(w, "  Crashed peers:    ", s.crashed())
+	fmt.Fprintln(w, "  Elections started:", s.Elections)
+
+	var msgs []string
+	for _, t := range types {
+		m := fmt.Sprintf("%s %d", t, s.Messages[t])
+		if len(s.uncounted(t)) > 0 {
+			m += "+"
+		}
+		msgs = append(msgs, m)
+	}
+	fmt.Fprintln(w, "  Messages sent:    ", strings.Join(msgs, ", "))
+	if ids := s.uncounted(""); len(ids) > 0 {
+		fmt.Fprintln(w, "  Not counted:       messages of peers", ids, "missing from their logs, + marks a lower bound")
+	}
+
+	if s.Check != nil {
+		s.Check.Write(w)
+	}
+}
+
+// Return the IDs of the crashed peers
+func (s Summary) crashed() []int {
+	ids := []int{}
+	for _, p := range s.Peers {
+		if p.Crashed {
+			ids = append(ids, p.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Return the IDs of the peers that did not count the messages of type t, of any type if t is empty
+func (s Summary) uncounted(t string) []int {
+	var ids []int
+	for _, p := range s.Peers {
+		if (t == "" && len(p.Unknown) > 0) || contains(p.Unknown, t) {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// Format the sum of the counters of the peer: "?" if no type is counted, with a "+" if some types are not
+func (p PeerState) count(m map[string]int) string {
+	switch {
+	case len(p.Unknown) == len(types):
+		return "?"
+	case len(p.Unknown) > 0:
+		return fmt.Sprintf("%d+", total(m))
+	}
+	return fmt.Sprint(total(m))
+}
+
+// Check if a slice of strings contains s
+func contains(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the sum of the counters
+func total(m map[string]int) int {
+	n := 0
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
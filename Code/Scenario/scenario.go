@@ -0,0 +1,234 @@
+package Scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"prog/Checker"
+	"prog/Events"
+	"prog/Faults"
+	"prog/Utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scenario struct, description of a run: the network, the faults over time and the expected outcome.
+// The zero value of a field means that the value is taken from the command line flags
+type Scenario struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Algorithm   string             `json:"algorithm,omitempty"` // Election algorithm: bully or ring
+	Peers       int                `json:"peers,omitempty"`     // Number of peers
+	MinPeers    int                `json:"min_peers,omitempty"` // Minimum number of peers required by the scenario
+	Heartbeat   int                `json:"heartbeat,omitempty"` // Duration of the heartbeat service shift in seconds
+	Replicas    int                `json:"replicas,omitempty"`  // Number of register replicas
+	Network     *Utils.NetworkConf `json:"network,omitempty"`   // Delay models, links and message faults
+	Crash       Crash              `json:"crash"`               // Peers that crash during the election
+	Faults      Faults.Schedule    `json:"faults,omitempty"`    // Faults injected through the control service
+	Expect      Expect             `json:"expect"`              // Expected outcome of the run
+}
+
+// Crash struct, peers that crash while taking part in an election
+type Crash struct {
+	Peers  []int   `json:"peers,omitempty"`  // IDs of the peers
+	Leader bool    `json:"leader,omitempty"` // If true the initial coordinator (highest ID) crashes
+	Random *Random `json:"random,omitempty"` // Random non coordinator peers
+}
+
+// Random struct, number of random non coordinator peers that crash
+type Random struct {
+	Min int `json:"min"`
+	Max int `json:"max,omitempty"` // If 0 up to all non coordinator peers
+}
+
+// Expect struct, outcome expected at the end of the run in addition to the checker properties
+type Expect struct {
+	Coordinator *int            `json:"coordinator,omitempty"`   // Coordinator agreed by the surviving peers
+	MaxLatency  Faults.Duration `json:"max_latency,omitempty"`   // Maximum duration of an election
+	Elections   int             `json:"min_elections,omitempty"` // Minimum number of completed elections
+	Partitioned []Group         `json:"partitioned,omitempty"`   // Coordinators known when the partition heals
+}
+
+// Group struct, peers that know the same coordinator
+type Group struct {
+	Peers       []int `json:"peers"`
+	Coordinator int   `json:"coordinator"`
+}
+
+// Load read a scenario from a JSON file
+func Load(path string) (*Scenario, error) {
+	j, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.DisallowUnknownFields()
+	err = d.Decode(&s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = path
+	}
+	return &s, s.Validate()
+}
+
+// Validate check the fields of the scenario that do not depend on the flags
+func (s *Scenario) Validate() error {
+	a := strings.ToLower(s.Algorithm)
+	if a != "" && a != "bully" && a != "ring" {
+		return fmt.Errorf("scenario %s: unknown algorithm %q (select \"bully\" or \"ring\")", s.Name, s.Algorithm)
+	}
+	if s.Peers < 0 || s.MinPeers < 0 || s.Heartbeat < 0 {
+		return fmt.Errorf("scenario %s: peers and heartbeat must not be negative", s.Name)
+	}
+	if s.Peers != 0 && s.Peers < s.MinPeers {
+		return fmt.Errorf("scenario %s: at least %d peers are required", s.Name, s.MinPeers)
+	}
+	if r := s.Crash.Random; r != nil && (r.Min < 0 || (r.Max != 0 && r.Max < r.Min)) {
+		return fmt.Errorf("scenario %s: invalid random crash range [%d, %d]", s.Name, r.Min, r.Max)
+	}
+	err := s.Faults.Validate()
+	if err != nil {
+		return fmt.Errorf("scenario %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// CrashPeers return the sorted IDs of the peers that crash in a network of n peers
+func (s *Scenario) CrashPeers(n int) ([]int, error) {
+	set := make(map[int]bool)
+	for _, p := range s.Crash.Peers {
+		if p < 0 || p >= n {
+			return nil, fmt.Errorf("scenario %s: crash peer %d out of range [0, %d)", s.Name, p, n)
+		}
+		set[p] = true
+	}
+	if s.Crash.Leader {
+		set[n-1] = true
+	}
+
+	// Pick random non coordinator peers
+	if r := s.Crash.Random; r != nil {
+		max := r.Max
+		if max == 0 || max > n-1 {
+			max = n - 1
+		}
+		if r.Min > max {
+			return nil, fmt.Errorf("scenario %s: %d random crashes with %d non coordinator peers", s.Name, r.Min, n-1)
+		}
+		num := r.Min + rand.Intn(max-r.Min+1)
+		for _, p := range rand.Perm(n - 1)[:num] {
+			set[p] = true
+		}
+	}
+
+	crash := make([]int, 0, len(set))
+	for p := range set {
+		crash = append(crash, p)
+	}
+	sort.Ints(crash)
+	return crash, nil
+}
+
+// Verify add to the report of the checker the properties expected by the scenario, events are the events
+// of the run
+func (s *Scenario) Verify(r *Checker.Report, crash []int, events []Events.Event) {
+
+	// Peers that had to crash must have crashed
+	p := Checker.Property{Name: "peers of the scenario crashed", Passed: true}
+	for _, c := range crash {
+		if !contains(r.Crashed, c) {
+			p.Passed = false
+			p.Details = append(p.Details, "peer "+strconv.Itoa(c)+" did not crash")
+		}
+	}
+	r.Properties = append(r.Properties, p)
+
+	if s.Expect.Coordinator != nil {
+		p := Checker.Property{Name: "expected coordinator", Passed: r.Coordinator == *s.Expect.Coordinator}
+		if !p.Passed {
+			p.Details = append(p.Details, fmt.Sprintf("coordinator is %d, expected %d", r.Coordinator,
+				*s.Expect.Coordinator))
+		}
+		r.Properties = append(r.Properties, p)
+	}
+
+	if s.Expect.Elections > 0 {
+		p := Checker.Property{Name: "expected elections", Passed: len(r.Elections) >= s.Expect.Elections}
+		if !p.Passed {
+			p.Details = append(p.Details, fmt.Sprintf("%d elections completed, expected at least %d",
+				len(r.Elections), s.Expect.Elections))
+		}
+		r.Properties = append(r.Properties, p)
+	}
+
+	// The coordinators known in the partitions are the last ones recognized before the first HEAL event
+	if len(s.Expect.Partitioned) > 0 {
+		p := Checker.Property{Name: "expected coordinators in the partitions", Passed: true}
+		known, healed := coordinatorsAtHeal(events)
+		if !healed {
+			p.Passed = false
+			p.Details = append(p.Details, "the partition was not healed")
+		}
+		for _, g := range s.Expect.Partitioned {
+			for _, id := range g.Peers {
+				c, ok := known[id]
+				switch {
+				case !ok:
+					p.Passed = false
+					p.Details = append(p.Details, fmt.Sprintf("peer %d recognized no coordinator in the partition, "+
+						"expected %d", id, g.Coordinator))
+				case c != g.Coordinator:
+					p.Passed = false
+					p.Details = append(p.Details, fmt.Sprintf("peer %d recognized %d in the partition, expected %d",
+						id, c, g.Coordinator))
+				}
+			}
+		}
+		r.Properties = append(r.Properties, p)
+	}
+
+	r.Passed = true
+	for _, p := range r.Properties {
+		r.Passed = r.Passed && p.Passed
+	}
+}
+
+// Return the coordinator recognized by each peer before the first HEAL event, false if there is none
+func coordinatorsAtHeal(events []Events.Event) (map[int]int, bool) {
+	var heal time.Time
+	for _, e := range events {
+		if e.Type == Events.HEAL && (heal.IsZero() || e.Time.Before(heal)) {
+			heal = e.Time
+		}
+	}
+	if heal.IsZero() {
+		return nil, false
+	}
+
+	known := make(map[int]int)
+	last := make(map[int]time.Time)
+	for _, e := range events {
+		if e.Type == Events.COORDINATOR && e.Time.Before(heal) && !e.Time.Before(last[e.Peer]) {
+			known[e.Peer] = e.To
+			last[e.Peer] = e.Time
+		}
+	}
+	return known, true
+}
+
+// Search an int from a slice of int
+func contains(slice []int, id int) bool {
+	for _, v := range slice {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
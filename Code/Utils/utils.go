@@ -1,7 +1,10 @@
 package Utils
 
 import (
-	"log"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Algorithm type
@@ -16,12 +19,34 @@ const (
 	OK
 	COORDINATOR
 	HEARTBEAT
+	LEAVE
+	TIMEOUT_NOW
 )
 
+// Names of the message types
+var msgNames = []string{"ELECTION", "OK", "COORDINATOR", "HEARTBEAT", "LEAVE", "TIMEOUT_NOW"}
+
+// MessageName return the name of a message type
+func MessageName(msg int) string {
+	if msg < 0 || msg >= len(msgNames) {
+		return "UNKNOWN"
+	}
+	return msgNames[msg]
+}
+
 // Message struct
 type Message struct {
-	ID  []int
-	Msg int
+	ID      []int
+	Msg     int
+	From    int   // ID of the sender
+	Seq     int   // Sequence number of the message, unique for each sender
+	Term    int   // Election term known by the sender
+	Lamport int   // Lamport timestamp of the send event
+	Vector  []int // Vector clock of the send event
+
+	Transfer bool // Set in the ELECTION messages of a leadership transfer, the other peers defer to the sender
+
+	Coordinator int // Coordinator known by the sender, set in HEARTBEAT replies
 }
 
 // Peer struct
@@ -37,21 +62,179 @@ type RegistrationReply struct {
 	ID    int
 }
 
-// Conf struct
-type Conf struct {
-	Register struct {
-		IP   string `json:"ip"`
-		Port string `json:"port"`
-	} `json:"register"`
-	Peer struct {
-		IP   string `json:"ip"`
-		Port string `json:"port"`
-	} `json:"peer"`
+// Membership event type
+const (
+	JOINED    = "join"    // A peer registered
+	REJOINED  = "rejoin"  // A restarted peer took back its ID
+	FAILED    = "failure" // A peer has been reported down
+	RECOVERED = "recover" // A peer reported down answers again
+	LEFT      = "leave"   // A peer left the network gracefully
+)
+
+// MemberEvent struct, change of the membership of the network
+type MemberEvent struct {
+	Version int    // Version of the membership after the change
+	Type    string // JOINED, REJOINED, FAILED, RECOVERED or LEFT
+	Peer    Peer
+	Time    time.Time
+}
+
+// WatchArgs struct, arguments of Register.Watch
+type WatchArgs struct {
+	Version int           // Version known by the caller, the call returns when the membership is newer
+	Timeout time.Duration // Maximum wait, if 0 the call returns immediately
 }
 
-// Print check the verbose flag and print in the command line
-func Print(verbose bool, a ...any) {
-	if verbose {
-		log.Println(a...)
+// Membership struct, peers of the network and their changes returned by Register.Watch
+type Membership struct {
+	Version int
+	Peers   []Peer
+	Down    []int         // IDs of the peers reported down
+	Left    []int         // IDs of the peers that left the network
+	Events  []MemberEvent // Changes after the version of the call, nil if they are no longer available
+}
+
+// NoLeader error of a register replica that does not know the leader, the call can be repeated on another one
+const NoLeader = "no leader among the register replicas"
+
+// DialRegister connect to the register service. addr is an address or a comma separated list of replicas,
+// the first one reachable is used
+func DialRegister(addr string) (*rpc.Client, error) {
+	var err error
+	for _, a := range strings.Split(addr, ",") {
+		var cli *rpc.Client
+		cli, err = rpc.DialHTTP("tcp", strings.TrimSpace(a))
+		if err == nil {
+			return cli, nil
+		}
 	}
+	return nil, err
+}
+
+// Status struct, state of a peer returned by its control endpoint
+type Status struct {
+	ID          int
+	Coordinator int
+	Term        int
+	Elections   int  // Number of elections started by the peer
+	Election    bool // If true the peer is taking part in an election
+	Paused      bool
+	Members     int            // Version of the membership known by the peer, 0 if it does not follow it
+	Down        []int          // Peers reported down by the register
+	Sent        map[string]int // Messages sent by type
+	Received    map[string]int // Messages received by type
+	Failed      map[string]int // Messages not delivered by type
+}
+
+// Block struct, one-way network partition rules applied by a peer
+type Block struct {
+	To   []int // Messages to these peers are dropped
+	From []int // Messages from these peers are dropped
+}
+
+// NetworkConf struct, delay model of the network and properties of single links
+type NetworkConf struct {
+	Delay     *DelayConf `json:"delay,omitempty"` // Default delay model, if nil DELAY_MODEL and DELAY are used
+	Links     []LinkConf `json:"links,omitempty"`
+	Drop      float64    `json:"drop,omitempty"`      // Probability that a message is lost
+	Duplicate float64    `json:"duplicate,omitempty"` // Probability that a message is delivered twice
+	Reorder   float64    `json:"reorder,omitempty"`   // Probability that a COORDINATOR message is delivered late
+}
+
+// DelayConf struct, a delay model with its parameters in ms
+type DelayConf struct {
+	Model  string  `json:"model"` // constant, uniform, exponential, normal or pareto
+	Value  float64 `json:"value,omitempty"`
+	Min    float64 `json:"min,omitempty"`
+	Max    float64 `json:"max,omitempty"`
+	Mean   float64 `json:"mean,omitempty"`
+	Stddev float64 `json:"stddev,omitempty"`
+	Scale  float64 `json:"scale,omitempty"`
+	Shape  float64 `json:"shape,omitempty"`
+}
+
+// LinkConf struct, delay model and loss probability of the messages sent from a peer to another
+type LinkConf struct {
+	From  int        `json:"from"`
+	To    int        `json:"to"`
+	Delay *DelayConf `json:"delay,omitempty"` // If nil the default delay model is used
+	Loss  float64    `json:"loss,omitempty"`  // Probability that a message is lost
+}
+
+// Clock struct, Lamport and vector logical clocks of a peer
+type Clock struct {
+	mu      sync.Mutex
+	id      int
+	lamport int
+	vector  []int
+}
+
+// NewClock create the clocks of peer id in a network of n peers
+func NewClock(id, n int) *Clock {
+	if n <= id {
+		n = id + 1
+	}
+	return &Clock{id: id, vector: make([]int, n)}
+}
+
+// Tick increment the clocks for a local or send event and return the new timestamps
+func (c *Clock) Tick() (int, []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lamport++
+	c.vector[c.id]++
+	return c.lamport, append([]int(nil), c.vector...)
+}
+
+// Receive merge the timestamps of a received message and return the new timestamps
+func (c *Clock) Receive(lamport int, vector []int) (int, []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lamport > c.lamport {
+		c.lamport = lamport
+	}
+	c.lamport++
+	for len(c.vector) < len(vector) {
+		c.vector = append(c.vector, 0)
+	}
+	for i, t := range vector {
+		if t > c.vector[i] {
+			c.vector[i] = t
+		}
+	}
+	c.vector[c.id]++
+	return c.lamport, append([]int(nil), c.vector...)
+}
+
+// Now return the current timestamps without incrementing them
+func (c *Clock) Now() (int, []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lamport, append([]int(nil), c.vector...)
+}
+
+// HappenedBefore check if the event with vector clock a happened before the event with vector clock b
+func HappenedBefore(a, b []int) bool {
+	strict := false
+	for i := 0; i < len(a) || i < len(b); i++ {
+		x, y := 0, 0
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x > y {
+			return false
+		}
+		if x < y {
+			strict = true
+		}
+	}
+	return strict
+}
+
+// Concurrent check if two events are not causally related
+func Concurrent(a, b []int) bool {
+	return !HappenedBefore(a, b) && !HappenedBefore(b, a)
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"prog/Web"
+)
+
+func main() {
+
+	// Set application flags
+	dirFlag := flag.String("logs", "logs", "Directory with the event logs of the run")
+	addrFlag := flag.String("addr", ":8080", "Address of the web server")
+	tFlag := flag.String("title", "", "Title of the page, e.g. the algorithm of the run")
+
+	// Retrieve flags value
+	flag.Parse()
+
+	// Serve the viewer until interrupted
+	s := Web.Server{Logs: *dirFlag, Title: *tFlag}
+	log.Println("Viewer listening on", *addrFlag)
+	err := s.ListenAndServe(*addrFlag)
+	if err != nil {
+		log.Fatalln("Viewer error:", err)
+	}
+}
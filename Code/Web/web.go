@@ -0,0 +1,214 @@
+package Web
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"prog/Events"
+	"sync"
+	"time"
+)
+
+// Page of the viewer
+//
+//go:embed index.html
+var index []byte
+
+// Messages buffered for a client, a slower client is disconnected
+const buffer = 4096
+
+// Server of the viewer, it follows the event logs of a run and streams the events to the browsers with SSE
+type Server struct {
+	Logs  string        // Directory of the event logs
+	Title string        // Shown on the page, e.g. the algorithm of the run
+	Poll  time.Duration // Interval between two reads of the logs, 100ms if zero
+
+	mu      sync.Mutex
+	history []Events.Event        // Events read since the start of the run
+	clients map[chan message]bool // Streams of the connected browsers
+	offsets map[string]int64      // Bytes read by log file, used only by the tail goroutine
+	once    sync.Once
+}
+
+// Message of the event stream
+type message struct {
+	name string // SSE event name, empty for protocol events
+	data []byte
+}
+
+// ListenAndServe follow the logs and serve the viewer on addr
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// Handler of the page and of the event stream, the logs are followed from the first call
+func (s *Server) Handler() http.Handler {
+	s.once.Do(func() {
+		if s.Poll <= 0 {
+			s.Poll = 100 * time.Millisecond
+		}
+		s.clients = make(map[chan message]bool)
+		s.offsets = make(map[string]int64)
+		go s.tail()
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(index)
+	})
+	mux.HandleFunc("/events", s.events)
+	return mux
+}
+
+// Stream the events: the run information and the history, then the new events as they are logged
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ch := make(chan message, buffer)
+	s.mu.Lock()
+	history, err := json.Marshal(s.history)
+	s.clients[ch] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, ch)
+		s.mu.Unlock()
+	}()
+	if err != nil {
+		return
+	}
+
+	info, _ := json.Marshal(map[string]string{"title": s.Title})
+	write(w, message{"info", info})
+	write(w, message{"history", history})
+	flusher.Flush()
+
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			write(w, m)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Write a message in the SSE format
+func write(w io.Writer, m message) {
+	if m.name != "" {
+		fmt.Fprintf(w, "event: %s\n", m.name)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", m.data)
+}
+
+// Read the new lines of the logs periodically
+func (s *Server) tail() {
+	for {
+		s.poll()
+		time.Sleep(s.Poll)
+	}
+}
+
+// Read the complete lines appended to the logs since the previous poll
+func (s *Server) poll() {
+	files, err := filepath.Glob(filepath.Join(s.Logs, "*.jsonl"))
+	if err != nil {
+		return
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			continue
+		}
+
+		// A shorter file belongs to a new run
+		off := s.offsets[name]
+		if info.Size() < off {
+			s.reset()
+			off = 0
+		}
+		if info.Size() == off {
+			f.Close()
+			continue
+		}
+
+		_, err = f.Seek(off, io.SeekStart)
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(f)
+		}
+		f.Close()
+		end := bytes.LastIndexByte(data, '\n')
+		if err != nil || end < 0 {
+			continue
+		}
+		s.offsets[name] = off + int64(end+1)
+
+		events, err := Events.Read(bytes.NewReader(data[:end+1]))
+		if err != nil {
+			log.Println(name, "error:", err)
+			continue
+		}
+		s.publish(events)
+	}
+}
+
+// Add the events to the history and send them to the browsers
+func (s *Server) publish(events []Events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, events...)
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		s.send(message{data: data})
+	}
+}
+
+// Forget the previous run, the browsers clear their state
+func (s *Server) reset() {
+	s.offsets = make(map[string]int64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = nil
+	s.send(message{"reset", []byte("{}")})
+}
+
+// Send a message to all browsers, disconnect the ones that do not keep up. Called with mu locked
+func (s *Server) send(m message) {
+	for ch := range s.clients {
+		select {
+		case ch <- m:
+		default:
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+}
@@ -2,7 +2,4 @@ module prog
 
 go 1.19
 
-require (
-	github.com/joho/godotenv v1.4.0
-	github.com/phayes/freeport v0.0.0-20220201140144-74d24b5ae9f5
-)
+require github.com/phayes/freeport v0.0.0-20220201140144-74d24b5ae9f5
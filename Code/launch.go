@@ -2,219 +2,393 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
-	"os/exec"
 	"os/signal"
-	"runtime"
-	"sort"
+	"prog/Checker"
+	"prog/Config"
+	"prog/Console"
+	"prog/Dashboard"
+	"prog/Docker"
+	"prog/Events"
+	"prog/Faults"
+	"prog/Local"
+	"prog/Report"
+	"prog/Scenario"
+	"prog/Utils"
+	"prog/Web"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
-var crash []int  // Peers that will crash while running a test
-var shell string // Shell used to run the program
-var arg string   // Shell argument
+var crash []int                    // Peers that will crash while running a scenario
+var scenario *Scenario.Scenario    // Scenario executed, nil if not running a scenario
+var numPeer int                    // Number of peers in the network
+var conf Config.Config             // Configuration of the run, passed to the register and the peers
+var cluster Cluster                // Register and peers of the run
+var register string                // Address of the register service, or comma separated addresses of its replicas
+var closing sync.Once              // Stop the run only once
+var dashboard *Dashboard.Dashboard // Dashboard of the run, nil if not shown
+
+const numSeeds = 3 // Seeds of the gossip discovery if not in config.json
+
+// Cluster of the register and peer services of a run, as local processes or Docker containers
+type Cluster interface {
+	Build() error                      // Build the binaries or images of the services
+	Start() error                      // Start the register, then the peers
+	Kill(name string) error            // Kill a process or container, e.g. "peer-1"
+	Stop()                             // Stop and remove all processes or containers
+	RestartRegister(replica int) error // Kill a register replica and start it again, it restores its state
+
+	// Start another peer, env is added to the configuration of the run
+	StartPeer(name string, env map[string]string) error
+}
 
 func main() {
 
-	// Check if the OS is Windows or Linux
-	switch runtime.GOOS {
-	case "windows":
-		log.Println("Running on Windows.")
-		shell = "cmd.exe"
-		arg = "/c"
-
-	case "linux":
-		log.Println("Running on Linux.")
-		shell = "/bin/sh"
-		arg = "-c"
-	}
-
 	// Handle SIGINT
 	go func() {
-
-		// Wait for SIGINT
-		sigCh := make(chan os.Signal)
+		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, os.Interrupt)
 		<-sigCh
-		log.Println("Closing the application.")
-
-		// Exec command 'docker-compose down'
-		cmd := exec.Command(shell, arg, "docker-compose down")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
-		if err != nil {
-			log.Fatalln("Command exec error \"docker-compose down\":", err)
-		}
-
-		// Delete .env file
-		err = os.Remove(".env")
-		if err != nil {
-			log.Fatalln("Remove error:", err)
-		}
-
-		os.Exit(0)
+		shutdown()
 	}()
 
-	// Set application flags
+	// Set application flags, the ones that are not set keep the values of config.json
+	def := Config.Default()
 	aFlag := flag.String("a", "", "Election algorithm (select \"bully\" or \"ring\")")
 	nFlag := flag.Int("n", 0, "Number of peers (at least 2)")
-	dFlag := flag.Int("d", 200, "Maximum random delay to forwarding messages")
-	hbFlag := flag.Int("hb", 2, "Duration of heartbeat service shift")
-	vFlag := flag.Bool("v", false, "Print some debug information")
-	vvFlag := flag.Bool("vv", false, "Print all debug information")
-	tFlag := flag.Int("t", 0, "Execute a test (select 1, 2 or 3")
+	dFlag := flag.Int("d", def.Delay, "Maximum random delay to forwarding messages (main parameter of the delay model)")
+	dmFlag := flag.String("dm", def.DelayModel, "Delay model (select constant, uniform, exponential, normal or pareto)")
+	dropFlag := flag.Float64("drop", 0, "Probability that a message is lost")
+	dupFlag := flag.Float64("dup", 0, "Probability that a message is delivered twice")
+	reorderFlag := flag.Float64("reorder", 0, "Probability that a COORDINATOR message is delivered out of order")
+	hbFlag := flag.Int("hb", def.Heartbeat, "Duration of heartbeat service shift")
+	vFlag := flag.Bool("v", false, "Print some debug information (same as -l debug)")
+	vvFlag := flag.Bool("vv", false, "Print all debug information (same as -l trace)")
+	lFlag := flag.String("l", def.LogLevel, "Log level of the events (select error, info, debug or trace)")
+	tFlag := flag.Int("t", 0, "Execute a test (select 1 to 10), same as -scenario Scenario/testN.json")
+	sFlag := flag.String("scenario", "", "JSON file with the scenario to run")
+	mFlag := flag.String("mode", "docker", "Run the peers in Docker containers or as local processes "+
+		"(select \"docker\" or \"local\")")
+	fFlag := flag.String("f", "", "JSON file with the schedule of the faults to inject")
+	cFlag := flag.Bool("console", false, "Read control commands from the standard input (kill, restart, partition...)")
+	dbFlag := flag.Bool("dashboard", false, "Show the state of the peers in real time instead of their output")
+	webFlag := flag.String("web", "", "Serve the web viewer of the messages on an address, e.g. :8080")
+	rFlag := flag.Int("replicas", 1, "Number of register replicas, on consecutive ports if not in config.json")
+	gFlag := flag.String("discovery", def.Discovery, "Discovery of the peers (select \"register\" or \"gossip\"), "+
+		"with gossip the register is not started")
 
 	// Retrieve flags value
 	flag.Parse()
-
-	// map used to add flags to .env file
-	mp := make(map[string]string)
-
-	// Check correctness of flags
-	*aFlag = strings.ToLower(*aFlag)
-	if *nFlag <= 1 || (*aFlag != "bully" && *aFlag != "ring") || *tFlag >= 4 {
+	if flag.NFlag() == 0 {
 		flag.Usage()
 		os.Exit(0)
 	}
 
-	// Check if executing test
-	if *tFlag != 0 {
+	// Set randomizer seed
+	rand.Seed(time.Now().UnixNano())
 
-		// At least 4 peers to run tests
-		if *nFlag <= 3 {
+	// Read the configuration from config.json and the environment, the flags that are set override it
+	var err error
+	conf, err = Config.Load("config.json")
+	if err != nil {
+		log.Fatalln("Configuration error:", err)
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["a"] {
+		conf.Algorithm = strings.ToLower(*aFlag)
+	}
+	if set["n"] {
+		conf.Peers = *nFlag
+	}
+	if set["d"] {
+		conf.Delay = *dFlag
+	}
+	if set["dm"] {
+		conf.DelayModel = strings.ToLower(*dmFlag)
+	}
+	if set["hb"] {
+		conf.Heartbeat = *hbFlag
+	}
+	if set["l"] {
+		conf.LogLevel = *lFlag
+	}
+	if set["discovery"] {
+		conf.Discovery = strings.ToLower(*gFlag)
+	}
+	level, err := Events.ParseLevel(conf.LogLevel)
+	if err == nil {
+		if *vFlag && level < Events.DEBUG {
+			level = Events.DEBUG
+		}
+		if *vvFlag {
+			level = Events.TRACE
+		}
+		conf.LogLevel = Events.LevelName(level)
+	}
+
+	// Load the scenario, the tests are shipped as scenario files
+	path := *sFlag
+	if *tFlag != 0 {
+		if *tFlag < 0 || *tFlag > 10 {
 			flag.Usage()
 			os.Exit(0)
 		}
+		path = "Scenario/test" + strconv.Itoa(*tFlag) + ".json"
+	}
+	if path != "" {
+		scenario, err = Scenario.Load(path)
+		if err != nil {
+			log.Fatalln("Load scenario error:", err)
+		}
 
-		// Set randomizer seed
-		rand.Seed(time.Now().UnixNano())
-
-		// Check test type
-		switch *tFlag {
-
-		// Crash one non coordinator peer
-		case 1:
-			crash = append(crash, rand.Intn(*nFlag-1))
-			log.Println("Running Test 1 with", *nFlag, "peers. The peer", crash[0], "will crash.")
-			mp["CRASH"] = strconv.Itoa(crash[0])
-
-		// Crash the coordinator peer
-		case 2:
-			crash = append(crash, *nFlag-1)
-			log.Println("Running Test 2 with", *nFlag, "peers. The coordinator peer will crash.")
-			mp["CRASH"] = strconv.Itoa(crash[0])
-
-		// Crash at least one non coordinator peer and the coordinator peer
-		case 3:
-			num := rand.Intn(*nFlag - 1)
-			for i := 0; i <= num; i++ {
-				p := rand.Intn(*nFlag - 1)
-				if !search(crash, p) {
-					crash = append(crash, p)
-				} else {
-					i--
-				}
-			}
-			crash = append(crash, *nFlag-1)
-			sort.Ints(crash)
-			log.Println("Running Test 3 with", *nFlag, "peers. Peers", crash[:len(crash)-1], ""+
-				"and the coordinator will crash.")
-
-			mp["CRASH"] = strconv.Itoa(crash[0])
-			for i := 1; i < len(crash); i++ {
-				mp["CRASH"] = mp["CRASH"] + ";" + strconv.Itoa(crash[i])
-			}
+		// The values of the scenario override the flags, the network replaces the one of the config file
+		if scenario.Algorithm != "" {
+			conf.Algorithm = strings.ToLower(scenario.Algorithm)
+		}
+		if scenario.Peers != 0 {
+			conf.Peers = scenario.Peers
+		}
+		if scenario.Heartbeat != 0 {
+			conf.Heartbeat = scenario.Heartbeat
+		}
+		if scenario.Network != nil {
+			conf.Network = *scenario.Network
+		}
+		if scenario.Replicas != 0 {
+			*rFlag = scenario.Replicas
+		}
+	}
 
+	// Register replicas on the ports that follow the one of the register
+	if *rFlag > 1 && len(conf.Replicas) == 0 {
+		port, err := strconv.Atoi(conf.Register.Port)
+		if err != nil {
+			log.Fatalln("Configuration error: invalid register port", conf.Register.Port)
+		}
+		for i := 0; i < *rFlag; i++ {
+			conf.Replicas = append(conf.Replicas, Config.Address{IP: conf.Register.IP, Port: strconv.Itoa(port + i)})
 		}
+	}
 
-	} else {
-		mp["CRASH"] = "-1" // Not running a test
+	// Gossip seeds on the ports that follow the one of the register, which is not started
+	if conf.Discovery == Config.GOSSIP && len(conf.Seeds) == 0 {
+		port, err := strconv.Atoi(conf.Register.Port)
+		if err != nil {
+			log.Fatalln("Configuration error: invalid register port", conf.Register.Port)
+		}
+		for i := 0; i < numSeeds && i < conf.Peers; i++ {
+			conf.Seeds = append(conf.Seeds, Config.Address{IP: conf.Peer.IP, Port: strconv.Itoa(port + i)})
+		}
 	}
 
-	// Create and open .env file
-	file, err := os.Create(".env")
-	if err != nil {
-		log.Fatalln("Crate error:", err)
+	// The probabilities of message faults override the network
+	if set["drop"] {
+		conf.Network.Drop = *dropFlag
+	}
+	if set["dup"] {
+		conf.Network.Duplicate = *dupFlag
+	}
+	if set["reorder"] {
+		conf.Network.Reorder = *reorderFlag
 	}
 
-	// Load .env file
-	err = godotenv.Load()
+	// Check correctness of flags and configuration
+	*mFlag = strings.ToLower(*mFlag)
+	if (*mFlag != "docker" && *mFlag != "local") || (*cFlag && *dbFlag) {
+		flag.Usage()
+		os.Exit(0)
+	}
+	err = conf.Validate()
 	if err != nil {
-		log.Fatalln("Load env error:", err)
+		log.Fatalln("Configuration error:", err)
 	}
+	numPeer = conf.Peers
 
-	// Set number of peers in .env file
-	mp["PEERS"] = strconv.Itoa(*nFlag)
+	// Faults to inject during the run
+	var schedule Faults.Schedule
 
-	// Set verbosity in .env file
-	if *vFlag && !*vvFlag {
-		mp["VERBOSE"] = "1"
-	}
+	// Set the crashing peers and the faults of the scenario
+	if scenario != nil {
+		if conf.Peers < scenario.MinPeers {
+			log.Fatalln("The scenario", scenario.Name, "requires at least", scenario.MinPeers, "peers.")
+		}
+
+		crash, err = scenario.CrashPeers(conf.Peers)
+		if err != nil {
+			log.Fatalln("Scenario error:", err)
+		}
+		log.Println("Running scenario", scenario.Name, "with", conf.Peers, "peers.", scenario.Description)
+		if len(crash) > 0 {
+			log.Println("Peers", crash, "will crash.")
+			conf.Crash = crash
+		}
 
-	// Set full verbosity in .env file
-	if *vvFlag {
-		mp["VERBOSE"] = "2"
+		schedule = append(schedule, scenario.Faults...)
 	}
 
-	// Set hbTime in .env file
-	mp["HEARTBEAT"] = strconv.Itoa(*hbFlag)
+	// Clean the event logs of the previous run
+	err = os.RemoveAll(conf.LogDir)
+	if err != nil {
+		log.Fatalln("Remove logs error:", err)
+	}
+	err = os.MkdirAll(conf.LogDir, 0755)
+	if err != nil {
+		log.Fatalln("Create logs error:", err)
+	}
 
-	// Set algorithm type in .env file
-	mp["ALGO"] = *aFlag
+	// Load the fault schedule
+	if *fFlag != "" {
+		s, err := Faults.Load(*fFlag)
+		if err != nil {
+			log.Fatalln("Load fault schedule error:", err)
+		}
+		schedule = append(schedule, s...)
+	}
 
-	// Set delay in .env file
-	mp["DELAY"] = strconv.Itoa(*dFlag)
+	// Build the binaries or the images, the output of the services is hidden by the dashboard.
+	// The configuration is passed to the services as environment variables.
+	// With gossip discovery the seed peers answer the requests to the register
+	register = strings.Join(conf.RegisterAddrs(), ",")
+	gossip := conf.Discovery == Config.GOSSIP
+	if gossip {
+		register = strings.Join(conf.SeedAddrs(), ",")
+	}
+	env := conf.Env()
+	out := io.Writer(os.Stdout)
+	if *dbFlag {
+		out = io.Discard
+	}
+	if *mFlag == "local" {
+		cluster = &Local.Cluster{Peers: conf.Peers, Register: register, Gossip: gossip, Env: env, Out: out}
+	} else {
+		cli, err := Docker.NewClient("")
+		if err != nil {
+			log.Fatalln("Docker client error:", err)
+		}
 
-	// Write .env file
-	err = godotenv.Write(mp, ".env")
+		// The logs directory is mounted in the working directory of the containers
+		env["LOG_DIR"] = "logs"
+		cluster = &Docker.Cluster{Client: cli, Context: "..", Peers: conf.Peers, Register: register,
+			Gossip: gossip, Logs: conf.LogDir, Env: env, Out: out}
+	}
+	err = cluster.Build()
 	if err != nil {
-		log.Fatalln("Write env error:", err)
+		cluster.Stop()
+		log.Fatalln("Build error:", err)
 	}
 
-	// Close .env file
-	err = file.Close()
-	if err != nil {
-		log.Fatalln("Close env error:", err)
+	// Goroutine that serves the web viewer, it follows the event logs of the run
+	if *webFlag != "" {
+		go func() {
+			s := Web.Server{Logs: conf.LogDir, Title: "Election " + conf.Algorithm + ", " + strconv.Itoa(conf.Peers) + " peers"}
+			log.Println("Web viewer on", *webFlag)
+			err := s.ListenAndServe(*webFlag)
+			if err != nil {
+				log.Println("Web viewer error:", err)
+			}
+		}()
+	}
+
+	// Start a new process for a crashed peer, it rejoins the network with the same ID
+	var restartMu sync.Mutex
+	restarts := 0
+	restart := func(id int) error {
+		restartMu.Lock()
+		restarts++
+		name := fmt.Sprintf("rejoin-%d.%d", id, restarts)
+		restartMu.Unlock()
+		return cluster.StartPeer(name, map[string]string{"REJOIN": strconv.Itoa(id), "CRASH": ""})
+	}
+
+	// Goroutine that injects the faults once all peers are registered
+	if len(schedule) > 0 {
+		go func() {
+			in := Faults.Injector{Register: register, Peers: conf.Peers, Restart: restart,
+				RestartRegister: cluster.RestartRegister}
+			err := in.Run(schedule, nil)
+			if err != nil {
+				log.Println("Fault injector error:", err)
+			}
+		}()
 	}
 
-	// Exec command 'docker-compose build'
-	cmd := exec.Command(shell, arg, "docker-compose build")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	err = cmd.Run()
+	// Start the services, the output is collected until SIGINT
+	err = cluster.Start()
 	if err != nil {
-		log.Fatalln("Command exec error \"docker-compose build\":", err)
+		cluster.Stop()
+		log.Fatalln("Start error:", err)
+	}
+
+	// Run the control console, the run stops with the quit command or at the end of the input
+	if *cFlag {
+		c := Console.Console{Register: register, Out: os.Stdout, Restart: restart,
+			RestartRegister: cluster.RestartRegister}
+		c.Run(os.Stdin)
+		shutdown()
 	}
 
-	// Exec command 'docker-compose up'
-	cmd = exec.Command(shell, arg, "docker-compose up")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	err = cmd.Run()
-	// The application handle the SIGINT error
-	if err != nil && err.Error() != "exit status 130" && err.Error() != "signal: interrupt" {
-		log.Fatalln("Command exec error \"docker-compose up\":", err)
+	// Show the dashboard until SIGINT
+	if *dbFlag {
+		dashboard = &Dashboard.Dashboard{Register: register, Logs: conf.LogDir, Out: os.Stdout}
+		dashboard.Run()
 	}
 
 	select {}
 }
 
-// Search an int from a slice of int
-func search(slice []int, j int) bool {
-	for i := 0; i <= len(slice)-1; i++ {
-		if slice[i] == j {
-			return true
-		}
+// Stop the run, print the summary and exit
+func shutdown() {
+	closing.Do(stopRun)
+}
+
+// Called once, by SIGINT or by the console
+func stopRun() {
+	if dashboard != nil {
+		dashboard.Stop()
 	}
-	return false
+	log.Println("Closing the application.")
+
+	// Gather the final state of the live peers before stopping them
+	status := Report.Status(register)
+
+	// Stop and remove the processes or containers
+	if cluster != nil {
+		cluster.Stop()
+	}
+
+	// Print the summary of the run and check the expectations of the scenario
+	if !report(status) {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// Print the summary of the run, return false if the expectations of the scenario do not hold
+func report(status map[int]Utils.Status) bool {
+	events, err := Events.ReadDir(conf.LogDir)
+	if err != nil {
+		log.Println("Read events error:", err)
+		return scenario == nil
+	}
+	summary := Report.New(numPeer, status, events)
+
+	// Check the properties of the elections if running a scenario
+	if scenario != nil {
+		opt := Checker.Options{Peers: numPeer, MaxLatency: time.Duration(scenario.Expect.MaxLatency)}
+		check := Checker.Check(events, opt)
+		scenario.Verify(&check, crash, events)
+		summary.Check = &check
+	}
+
+	summary.Write(os.Stdout)
+	return summary.Check == nil || summary.Check.Passed
 }